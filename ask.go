@@ -0,0 +1,99 @@
+package main
+
+import (
+	"github.com/indium114/spyglass/lens"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// question is asked in the search box before an action runs: first the
+// action's input, if it has one, then its confirmation
+type question struct {
+	action lens.Action
+	stay   bool
+
+	// The input, once it's been given
+	text       string
+	confirming bool
+
+	// The search box as it was, put back once the question is answered
+	query       string
+	prompt      string
+	placeholder string
+}
+
+// ask starts asking what action needs to know before it runs
+func (m *model) ask(action lens.Action, stay bool) {
+	m.asking = &question{
+		action:      action,
+		stay:        stay,
+		query:       m.search.Value(),
+		prompt:      m.search.Prompt,
+		placeholder: m.search.Placeholder,
+	}
+	m.search.Placeholder = ""
+
+	if action.Input != nil {
+		m.search.Prompt = action.Input.Prompt + ": "
+		m.search.SetValue(action.Input.Value)
+		m.search.CursorEnd()
+	} else {
+		m.confirm()
+	}
+}
+
+// confirm asks whether to go ahead with the action
+func (m *model) confirm() {
+	m.asking.confirming = true
+	m.search.Prompt = m.asking.action.Confirm + " [y/N] "
+	m.search.SetValue("")
+}
+
+// answer handles a key pressed while a question is asked. Enter gives the
+// input, y confirms, and anything else, like Esc, cancels.
+func (m *model) answer(msg tea.KeyMsg) tea.Cmd {
+	q := m.asking
+
+	if key.Matches(msg, m.keys.Quit) {
+		return m.quit()
+	}
+
+	if !q.confirming {
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			m.stopAsking()
+			return nil
+
+		case key.Matches(msg, m.keys.Enter, m.keys.EnterStay):
+			q.text = m.search.Value()
+			if q.action.Confirm != "" {
+				m.confirm()
+				return nil
+			}
+			m.stopAsking()
+			return m.runAction(q.action, q.text, q.stay)
+		}
+
+		var cmd tea.Cmd
+		m.search, cmd = m.search.Update(msg)
+		return cmd
+	}
+
+	m.stopAsking()
+	if msg.String() == "y" || msg.String() == "Y" {
+		return m.runAction(q.action, q.text, q.stay)
+	}
+	return nil
+}
+
+// stopAsking puts the search box back as it was
+func (m *model) stopAsking() {
+	q := m.asking
+	m.asking = nil
+
+	m.search.Prompt = q.prompt
+	m.search.Placeholder = q.placeholder
+	m.search.SetValue(q.query)
+	m.search.CursorEnd()
+}
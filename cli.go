@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/indium114/spyglass/lens"
+)
+
+// options are set by command line flags
+type options struct {
+	// Pick from lines read from standard input, and print the chosen ones
+	dmenu bool
+	// Shown before the search box
+	prompt string
+	// Print the index of the chosen lines, rather than the lines
+	index bool
+	// Allow choosing more than one entry
+	multi bool
+
+	// Lens to start in, and query to start with
+	lens  string
+	query string
+	// Lenses to show, in tab order, instead of those in the config file
+	only []string
+
+	// Print the chosen entries' IDs, or the entries as JSON, instead of
+	// opening them
+	print bool
+	json  bool
+
+	// Load lenses here even if the daemon is running
+	noDaemon bool
+}
+
+// picking reports whether spyglass prints the chosen entries, rather than
+// opening them
+func (o options) picking() bool {
+	return o.dmenu || o.print || o.json
+}
+
+func parseFlags(args []string) (options, error) {
+	var opts options
+
+	fs := flag.NewFlagSet("spyglass", flag.ContinueOnError)
+	fs.BoolVar(&opts.dmenu, "dmenu", false, "pick from lines read from standard input, and print the chosen line")
+	fs.StringVar(&opts.prompt, "p", "", "`prompt` shown before the search box")
+	fs.BoolVar(&opts.index, "index", false, "with --dmenu, print the index of the chosen line instead of the line")
+	fs.BoolVar(&opts.multi, "multi", false, "allow choosing several entries, marking them with ctrl+space")
+	fs.StringVar(&opts.lens, "lens", "", "`name` of the lens to start in")
+	fs.StringVar(&opts.query, "query", "", "`text` to start searching for")
+	fs.Func("only", "comma-separated `names` of the lenses to show, in tab order", func(s string) error {
+		for _, name := range strings.Split(s, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				opts.only = append(opts.only, name)
+			}
+		}
+		return nil
+	})
+	fs.BoolVar(&opts.print, "print", false, "print the chosen entry's ID instead of opening it")
+	fs.BoolVar(&opts.json, "json", false, "print the chosen entry as JSON instead of opening it")
+	fs.BoolVar(&opts.noDaemon, "no-daemon", false, "load lenses in this process, even if the daemon is running")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	// Report other mistakes the way the flag package does
+	fail := func(err error) (options, error) {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return opts, err
+	}
+
+	if fs.NArg() > 0 {
+		return fail(fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	if opts.print && opts.json {
+		return fail(errors.New("--print and --json can't be used together"))
+	}
+	if opts.dmenu && (opts.lens != "" || len(opts.only) > 0) {
+		return fail(errors.New("--lens and --only can't be used with --dmenu"))
+	}
+	return opts, nil
+}
+
+// pickedEntry is an entry along with the name of the lens it came from, as
+// printed in JSON
+type pickedEntry struct {
+	Lens string `json:"lens"`
+	lens.Entry
+}
+
+// printPicked prints the chosen entries, one per line
+func printPicked(opts options, picked []pickedEntry) error {
+	enc := json.NewEncoder(os.Stdout)
+
+	for _, e := range picked {
+		switch {
+		case opts.json:
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		case opts.print, opts.index:
+			fmt.Println(e.ID)
+		default:
+			fmt.Println(e.Title)
+		}
+	}
+	return nil
+}
+
+// exitWithError reports an error that stops spyglass from starting. It goes
+// to standard error, so it isn't mistaken for a choice when picking.
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/indium114/spyglass/config"
+	"github.com/indium114/spyglass/daemon"
+	"github.com/indium114/spyglass/history"
+	"github.com/indium114/spyglass/lens"
+)
+
+// Subcommands run lenses without the interface, for scripts and testing, or
+// keep them loaded in the background
+var subcommands = map[string]func(args []string) error{
+	"search": searchCommand,
+	"run":    runCommand,
+	"daemon": daemonCommand,
+}
+
+// searchCommand prints a lens's results for a query, best first
+func searchCommand(args []string) error {
+	fs := flag.NewFlagSet("spyglass search", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: spyglass search --lens <name> [--json] [--limit n] <query>")
+		fs.PrintDefaults()
+	}
+	name := fs.String("lens", "", "`name` of the lens to search")
+	asJSON := fs.Bool("json", false, "print JSON lines instead of tab-separated values")
+	limit := fs.Int("limit", 0, "print at most `n` results, 0 for all")
+	_ = fs.Parse(args)
+
+	l, err := commandLens(*name)
+	if err != nil {
+		return err
+	}
+	// Lets the Files lens finish saving its index
+	defer closeLenses()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	query := strings.Join(fs.Args(), " ")
+	entries, err := lens.SearchContext(ctx, l, query)
+	if err != nil {
+		return err
+	}
+
+	slices.SortStableFunc(entries, func(a, b lens.Entry) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[:*limit]
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, entry := range entries {
+		origin, e := lens.Origin(l, entry)
+
+		if *asJSON {
+			if err := enc.Encode(pickedEntry{Lens: origin.Name(), Entry: e}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fields := []string{e.ID, e.Title, e.Icon, e.Description, strconv.Itoa(entry.Score)}
+		for i, f := range fields {
+			// Keep each entry to one line, with one tab between fields
+			fields[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", "").Replace(f)
+		}
+		fmt.Println(strings.Join(fields, "\t"))
+	}
+	return nil
+}
+
+// runCommand opens an entry, or runs one of its context actions
+func runCommand(args []string) error {
+	fs := flag.NewFlagSet("spyglass run", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: spyglass run --lens <name> --id <id> [--action <name> [--input <text>]]")
+		fs.PrintDefaults()
+	}
+	name := fs.String("lens", "", "`name` of the entry's lens")
+	id := fs.String("id", "", "`id` of the entry, as printed by spyglass search")
+	action := fs.String("action", "", "`name` of the context action to run, instead of opening the entry")
+	input := fs.String("input", "", "`text` for an action that asks for it, like a new name")
+	_ = fs.Parse(args)
+
+	if *id == "" {
+		return errors.New("--id is required")
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	l, err := commandLens(*name)
+	if err != nil {
+		return err
+	}
+	// Lets the Files lens finish saving its index
+	defer closeLenses()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	entry, err := findEntry(ctx, l, *id)
+	if err != nil {
+		return err
+	}
+
+	if *action == "" {
+		if err := l.Enter(entry); err != nil {
+			return err
+		}
+
+		origin, e := lens.Origin(l, entry)
+		return history.Load().Record(origin.Name(), e.ID)
+	}
+
+	var names []string
+	for _, a := range l.ContextActions(entry) {
+		// The ellipsis of actions asking for input is optional
+		if strings.EqualFold(a.Name, *action) || strings.EqualFold(strings.TrimSuffix(a.Name, "…"), *action) {
+			if a.Input != nil {
+				return a.Input.Run(entry, *input)
+			}
+			return a.Run(entry)
+		}
+		names = append(names, strconv.Quote(a.Name))
+	}
+
+	if len(names) == 0 {
+		return fmt.Errorf("entry %q has no actions", *id)
+	}
+	return fmt.Errorf("unknown action %q, expected one of %s", *action, strings.Join(names, ", "))
+}
+
+// commandLens returns the named lens, configured from the config file
+func commandLens(name string) (lens.Lens, error) {
+	if name == "" {
+		return nil, errors.New("--lens is required")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	available, err := localLenses(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	lenses, err := pickLenses(available, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	return lenses[0], nil
+}
+
+// findEntry looks for the entry with the given ID among everything the lens
+// lists for an empty query. Lenses that don't list anything without a query
+// get an entry with just the ID, which is all most of them look at.
+func findEntry(ctx context.Context, l lens.Lens, id string) (lens.Entry, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var found *lens.Entry
+	err := lens.SearchStream(ctx, l, "", func(batch []lens.Entry) {
+		if found != nil {
+			return
+		}
+		for _, e := range batch {
+			if e.ID == id {
+				found = &e
+				cancel()
+				return
+			}
+		}
+	})
+
+	if found != nil {
+		return *found, nil
+	}
+	if err != nil {
+		return lens.Entry{}, err
+	}
+	return lens.Entry{ID: id, Title: id}, nil
+}
+
+// daemonCommand keeps every lens loaded, serving searches to spyglass over a
+// Unix socket until it's interrupted
+func daemonCommand(args []string) error {
+	fs := flag.NewFlagSet("spyglass daemon", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: spyglass daemon")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	lenses, err := localLenses(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	defer closeLenses()
+
+	return daemon.Serve(ctx, daemon.SocketPath(), lenses)
+}
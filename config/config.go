@@ -0,0 +1,172 @@
+// Package config loads spyglass's configuration file,
+// ~/.config/spyglass/config.yaml.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/indium114/spyglass/theme"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	// Lenses to show, by name, in tab order. "All" is the tab that searches
+	// the other lenses shown. If empty, every registered lens is shown, after
+	// "All".
+	Lenses []string `yaml:"lenses"`
+	// Lens to start in
+	DefaultLens string `yaml:"default_lens"`
+	// Keywords that jump to a lens, by lens name. These override the lens's
+	// own keyword, and an empty keyword turns it off.
+	Keywords map[string]string `yaml:"keywords"`
+	// Key bindings, by action
+	Keys map[string][]string `yaml:"keys"`
+
+	Layout Layout `yaml:"layout"`
+	Theme  Theme  `yaml:"theme"`
+
+	// Each lens's own section, by lens name
+	Lens map[string]yaml.Node `yaml:"lens"`
+
+	// External programs providing lenses
+	Plugins []Plugin `yaml:"plugins"`
+}
+
+// Plugin is an external program providing a lens, spoken to over its
+// standard input and output
+type Plugin struct {
+	// Shell command starting the plugin
+	Command string `yaml:"command"`
+	// Name of the lens. If empty, the plugin is started to ask for it.
+	Name string `yaml:"name"`
+	// How long the plugin gets to answer each request
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Layout sets the height of each part of the interface, including borders
+type Layout struct {
+	Tabs        int `yaml:"tabs"`
+	Description int `yaml:"description"`
+	Search      int `yaml:"search"`
+	// Width of the preview pane, as a percentage of the window. 0 hides it.
+	Preview int `yaml:"preview"`
+}
+
+// Theme picks a theme by name, and overrides any of its settings. In the
+// config file it can be either a mapping, or just the theme's name.
+type Theme struct {
+	Name        string `yaml:"name"`
+	theme.Theme `yaml:",inline"`
+}
+
+func (t *Theme) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&t.Name)
+	}
+
+	// Decode through another type, so this method isn't called again
+	type plain Theme
+	return node.Decode((*plain)(t))
+}
+
+// ThemesDir returns the directory user themes are read from
+func ThemesDir() string {
+	return filepath.Join(Dir(), "themes")
+}
+
+// LensesDir returns the directory script lenses are read from
+func LensesDir() string {
+	return filepath.Join(Dir(), "lenses")
+}
+
+func Default() Config {
+	return Config{
+		Layout: Layout{
+			Tabs:        3,
+			Description: 5,
+			Search:      3,
+			Preview:     50,
+		},
+		Theme: Theme{
+			Name: theme.DefaultName,
+		},
+	}
+}
+
+// Dir returns spyglass's configuration directory, respecting
+// $XDG_CONFIG_HOME
+func Dir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "spyglass")
+	}
+
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "spyglass")
+}
+
+// ExpandHome replaces a leading ~ in path with the user's home directory
+func ExpandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	return path
+}
+
+// Path returns the location of the configuration file
+func Path() string {
+	return filepath.Join(Dir(), "config.yaml")
+}
+
+// Load reads the configuration file. Settings missing from the file, or the
+// whole file if it doesn't exist, take their default values.
+func Load() (Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(Path())
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", Path(), err)
+	}
+
+	return cfg, nil
+}
+
+// Keyword returns the keyword configured for the named lens, if any
+func (c Config) Keyword(name string) (string, bool) {
+	for key, kw := range c.Keywords {
+		if strings.EqualFold(key, name) {
+			return kw, true
+		}
+	}
+	return "", false
+}
+
+// LensSection returns a function decoding the named lens's section into a
+// value, or false if there isn't one. Lens names are case-insensitive.
+func (c Config) LensSection(name string) (func(v any) error, bool) {
+	for key, node := range c.Lens {
+		if strings.EqualFold(key, name) {
+			return func(v any) error {
+				if err := node.Decode(v); err != nil {
+					return fmt.Errorf("lens %s: %w", name, err)
+				}
+				return nil
+			}, true
+		}
+	}
+	return nil, false
+}
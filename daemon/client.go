@@ -0,0 +1,295 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/indium114/spyglass/lens"
+)
+
+// How long to wait for the daemon to answer, before deciding it isn't running
+const dialTimeout = 200 * time.Millisecond
+
+// How long a request other than a search or preview may take. They're made
+// while the interface waits, so a daemon that's stuck mustn't hang it.
+const requestTimeout = 10 * time.Second
+
+type client struct {
+	path string
+
+	// Every lens the daemon serves, by name
+	lenses map[string]lens.Lens
+}
+
+// Connect returns the lenses served by the daemon listening at path, in the
+// daemon's order. Searching them, and opening their entries, happens in the
+// daemon. It fails quickly if no daemon is running.
+func Connect(path string) ([]lens.Lens, error) {
+	c := &client{
+		path:   path,
+		lenses: make(map[string]lens.Lens),
+	}
+
+	var infos []lensInfo
+	err := c.request(request{Method: "lenses"}, func(r response) {
+		infos = append(infos, r.Lenses...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var lenses []lens.Lens
+	for _, info := range infos {
+		r := &remoteLens{
+			client:  c,
+			info:    info,
+			origins: make(map[string]origin),
+		}
+
+		var l lens.Lens = r
+		switch {
+		case info.Resolver:
+			l = &resolvingLens{r}
+		case info.Previewer:
+			l = &previewingLens{r}
+		}
+
+		c.lenses[info.Name] = l
+		lenses = append(lenses, l)
+	}
+	return lenses, nil
+}
+
+// call sends req to the daemon and hands each response to handle, until the
+// daemon is done. Cancelling ctx hangs up, which cancels the request.
+func (c *client) call(ctx context.Context, req request, handle func(response)) error {
+	if err := checkSocket(c.path); err != nil {
+		return err
+	}
+
+	d := net.Dialer{Timeout: dialTimeout}
+	conn, err := d.DialContext(ctx, "unix", c.path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(conn)
+	for {
+		var resp response
+		if err := dec.Decode(&resp); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		if resp.Done {
+			if resp.Error != "" {
+				return errors.New(resp.Error)
+			}
+			return nil
+		}
+		handle(resp)
+	}
+}
+
+// request is call, giving up after requestTimeout
+func (c *client) request(req request, handle func(response)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	err := c.call(ctx, req, handle)
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("the daemon didn't answer %s within %v", req.Method, requestTimeout)
+	}
+	return err
+}
+
+// origin is where an entry shown by a lens like All came from
+type origin struct {
+	lens  string
+	entry lens.Entry
+}
+
+// remoteLens is a lens served by the daemon
+type remoteLens struct {
+	client *client
+	info   lensInfo
+
+	// Origins of the entries found so far, by ID
+	mu      sync.Mutex
+	origins map[string]origin
+}
+
+func (r *remoteLens) Name() string {
+	return r.info.Name
+}
+
+func (r *remoteLens) Keyword() string {
+	return r.info.Keyword
+}
+
+func (r *remoteLens) Search(query string) ([]lens.Entry, error) {
+	return lens.SearchContext(context.Background(), r, query)
+}
+
+func (r *remoteLens) SearchStream(ctx context.Context, query string, push func([]lens.Entry)) error {
+	req := request{Method: "search", Lens: r.info.Name, Query: query}
+
+	return r.client.call(ctx, req, func(resp response) {
+		batch := make([]lens.Entry, len(resp.Entries))
+		for i, res := range resp.Entries {
+			batch[i] = res.Entry
+
+			if res.OriginEntry != nil {
+				r.mu.Lock()
+				r.origins[res.ID] = origin{lens: res.Origin, entry: *res.OriginEntry}
+				r.mu.Unlock()
+			}
+		}
+		push(batch)
+	})
+}
+
+func (r *remoteLens) Enter(entry lens.Entry) error {
+	req := request{Method: "enter", Lens: r.info.Name, Entry: &entry}
+	return r.client.request(req, func(response) {})
+}
+
+func (r *remoteLens) ContextActions(entry lens.Entry) []lens.Action {
+	req := request{Method: "actions", Lens: r.info.Name, Entry: &entry}
+
+	var actions []lens.Action
+	err := r.client.request(req, func(resp response) {
+		for _, info := range resp.Actions {
+			run := func(e lens.Entry, text string) error {
+				req := request{Method: "action", Lens: r.info.Name, Entry: &e, Action: info.Name, Text: text}
+				return r.client.request(req, func(response) {})
+			}
+
+			a := lens.Action{
+				Name:    info.Name,
+				After:   info.After,
+				Confirm: info.Confirm,
+				Run: func(e lens.Entry) error {
+					return run(e, "")
+				},
+			}
+			if info.Input != nil {
+				a.Input = &lens.Input{Prompt: info.Input.Prompt, Value: info.Input.Value, Run: run}
+			}
+			actions = append(actions, a)
+		}
+	})
+	if err != nil {
+		// Shown in place of the actions, and reported if it's run
+		return []lens.Action{{
+			Name:  "No actions: " + err.Error(),
+			After: lens.AfterStay,
+			Run: func(lens.Entry) error {
+				return err
+			},
+		}}
+	}
+	return actions
+}
+
+func (r *remoteLens) EnterBatch(entries []lens.Entry) error {
+	req := request{Method: "enterBatch", Lens: r.info.Name, Entries: entries}
+	return r.client.request(req, func(response) {})
+}
+
+func (r *remoteLens) BatchActions(entries []lens.Entry) []lens.BatchAction {
+	req := request{Method: "batchActions", Lens: r.info.Name, Entries: entries}
+
+	var actions []lens.BatchAction
+	err := r.client.request(req, func(resp response) {
+		for _, info := range resp.Actions {
+			actions = append(actions, lens.BatchAction{
+				Name:    info.Name,
+				After:   info.After,
+				Confirm: info.Confirm,
+				Run: func(entries []lens.Entry) error {
+					req := request{Method: "batchAction", Lens: r.info.Name, Entries: entries, Action: info.Name}
+					return r.client.request(req, func(response) {})
+				},
+			})
+		}
+	})
+	if err != nil {
+		return []lens.BatchAction{{
+			Name:  "No actions: " + err.Error(),
+			After: lens.AfterStay,
+			Run: func([]lens.Entry) error {
+				return err
+			},
+		}}
+	}
+	return actions
+}
+
+func (r *remoteLens) Status() string {
+	// Most lenses are never busy, so don't ask them
+	if !r.info.Statuser {
+		return ""
+	}
+
+	req := request{Method: "status", Lens: r.info.Name}
+
+	var text string
+	_ = r.client.request(req, func(resp response) {
+		text = resp.Status
+	})
+	return text
+}
+
+// previewingLens is a remote lens with previews
+type previewingLens struct {
+	*remoteLens
+}
+
+func (p *previewingLens) Preview(ctx context.Context, entry lens.Entry) (string, error) {
+	req := request{Method: "preview", Lens: p.info.Name, Entry: &entry}
+
+	var text string
+	err := p.client.call(ctx, req, func(resp response) {
+		text = resp.Preview
+	})
+	return text, err
+}
+
+// resolvingLens is a remote lens showing entries from other lenses
+type resolvingLens struct {
+	*remoteLens
+}
+
+func (r *resolvingLens) Resolve(entry lens.Entry) (lens.Lens, lens.Entry, bool) {
+	r.mu.Lock()
+	o, ok := r.origins[entry.ID]
+	r.mu.Unlock()
+	if !ok {
+		return nil, lens.Entry{}, false
+	}
+
+	l, ok := r.client.lenses[o.lens]
+	return l, o.entry, ok
+}
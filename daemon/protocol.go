@@ -0,0 +1,80 @@
+// Package daemon keeps lenses loaded in a long-running process, and lets
+// spyglass search them over a Unix socket instead of loading its own.
+//
+// Each request is a JSON object on its own connection. The daemon answers
+// with any number of JSON responses, the last of which has done set. Closing
+// the connection early cancels the request.
+package daemon
+
+import (
+	"github.com/indium114/spyglass/lens"
+)
+
+type request struct {
+	// One of lenses, search, enter, actions, action, preview or status, or
+	// enterBatch, batchActions or batchAction for several entries
+	Method  string       `json:"method"`
+	Lens    string       `json:"lens,omitempty"`
+	Query   string       `json:"query,omitempty"`
+	Entry   *lens.Entry  `json:"entry,omitempty"`
+	Entries []lens.Entry `json:"entries,omitempty"`
+	Action  string       `json:"action,omitempty"`
+	// The text given to an action asking for input
+	Text string `json:"text,omitempty"`
+}
+
+type response struct {
+	Lenses  []lensInfo   `json:"lenses,omitempty"`
+	Entries []result     `json:"entries,omitempty"`
+	Actions []actionInfo `json:"actions,omitempty"`
+
+	Preview    string `json:"preview,omitempty"`
+	HasPreview bool   `json:"has_preview,omitempty"`
+
+	Status string `json:"status,omitempty"`
+
+	Done  bool   `json:"done,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// lensInfo describes a lens served by the daemon
+type lensInfo struct {
+	Name    string `json:"name"`
+	Keyword string `json:"keyword,omitempty"`
+	// Whether the lens implements lens.Previewer, lens.Resolver or
+	// lens.Statuser
+	Previewer bool `json:"previewer,omitempty"`
+	Resolver  bool `json:"resolver,omitempty"`
+	Statuser  bool `json:"statuser,omitempty"`
+}
+
+// actionInfo describes a context action
+type actionInfo struct {
+	Name    string     `json:"name"`
+	After   lens.After `json:"after"`
+	Confirm string     `json:"confirm,omitempty"`
+	Input   *inputInfo `json:"input,omitempty"`
+}
+
+// inputInfo describes the text an action asks for
+type inputInfo struct {
+	Prompt string `json:"prompt"`
+	Value  string `json:"value,omitempty"`
+}
+
+// newActionInfo describes a context action
+func newActionInfo(a lens.Action) actionInfo {
+	info := actionInfo{Name: a.Name, After: a.After, Confirm: a.Confirm}
+	if a.Input != nil {
+		info.Input = &inputInfo{Prompt: a.Input.Prompt, Value: a.Input.Value}
+	}
+	return info
+}
+
+// result is an entry found by a search. Entries shown by a lens like All
+// carry the lens they came from, and the entry as that lens produced it.
+type result struct {
+	lens.Entry
+	Origin      string      `json:"origin,omitempty"`
+	OriginEntry *lens.Entry `json:"origin_entry,omitempty"`
+}
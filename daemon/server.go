@@ -0,0 +1,226 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/indium114/spyglass/lens"
+)
+
+// How often lenses that keep data in memory are refreshed
+const refreshEvery = 15 * time.Minute
+
+type server struct {
+	lenses []lens.Lens
+}
+
+// Serve answers requests for lenses on a Unix socket at path, until ctx is
+// done. Lenses implementing lens.Refresher are refreshed in the background.
+func Serve(ctx context.Context, path string, lenses []lens.Lens) error {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("a daemon is already running at %s", path)
+	}
+
+	ln, err := listen(path)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	go refresh(ctx, lenses)
+
+	log.Println("listening on", path)
+
+	s := &server{lenses: lenses}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// refresh refreshes lenses now, and then periodically until ctx is done
+func refresh(ctx context.Context, lenses []lens.Lens) {
+	ticker := time.NewTicker(refreshEvery)
+	defer ticker.Stop()
+
+	for {
+		for _, l := range lenses {
+			if r, ok := l.(lens.Refresher); ok {
+				go r.Refresh()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var req request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+
+	// The client hangs up to cancel the request
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		cancel()
+	}()
+
+	// Searches can push from several goroutines at once
+	var mu sync.Mutex
+	enc := json.NewEncoder(conn)
+	send := func(r response) {
+		mu.Lock()
+		defer mu.Unlock()
+		_ = enc.Encode(r)
+	}
+
+	done := response{Done: true}
+	if err := s.serve(ctx, req, send); err != nil {
+		done.Error = err.Error()
+	}
+	send(done)
+}
+
+func (s *server) serve(ctx context.Context, req request, send func(response)) error {
+	if req.Method == "lenses" {
+		var infos []lensInfo
+		for _, l := range s.lenses {
+			info := lensInfo{Name: l.Name()}
+			if k, ok := l.(lens.Keyworder); ok {
+				info.Keyword = k.Keyword()
+			}
+			_, info.Previewer = l.(lens.Previewer)
+			_, info.Resolver = l.(lens.Resolver)
+			_, info.Statuser = l.(lens.Statuser)
+			infos = append(infos, info)
+		}
+		send(response{Lenses: infos})
+		return nil
+	}
+
+	l, err := s.lens(req.Lens)
+	if err != nil {
+		return err
+	}
+
+	if req.Method == "search" {
+		return lens.SearchStream(ctx, l, req.Query, func(batch []lens.Entry) {
+			results := make([]result, len(batch))
+			for i, e := range batch {
+				results[i].Entry = e
+				if origin, oe := lens.Origin(l, e); origin != l {
+					results[i].Origin = origin.Name()
+					results[i].OriginEntry = &oe
+				}
+			}
+			send(response{Entries: results})
+		})
+	}
+
+	switch req.Method {
+	case "status":
+		if st, ok := l.(lens.Statuser); ok {
+			send(response{Status: st.Status()})
+		}
+		return nil
+
+	case "enterBatch":
+		return lens.EnterBatch(l, req.Entries)
+
+	case "batchActions":
+		var infos []actionInfo
+		for _, a := range lens.BatchActions(l, req.Entries) {
+			infos = append(infos, actionInfo{Name: a.Name, After: a.After, Confirm: a.Confirm})
+		}
+		send(response{Actions: infos})
+		return nil
+
+	case "batchAction":
+		for _, a := range lens.BatchActions(l, req.Entries) {
+			if a.Name == req.Action {
+				return a.Run(req.Entries)
+			}
+		}
+		return fmt.Errorf("unknown action %q", req.Action)
+	}
+
+	if req.Entry == nil {
+		return fmt.Errorf("%s needs an entry", req.Method)
+	}
+	entry := *req.Entry
+
+	switch req.Method {
+	case "enter":
+		return l.Enter(entry)
+
+	case "actions":
+		var infos []actionInfo
+		for _, a := range l.ContextActions(entry) {
+			infos = append(infos, newActionInfo(a))
+		}
+		send(response{Actions: infos})
+		return nil
+
+	case "action":
+		for _, a := range l.ContextActions(entry) {
+			if a.Name == req.Action {
+				if a.Input != nil {
+					return a.Input.Run(entry, req.Text)
+				}
+				return a.Run(entry)
+			}
+		}
+		return fmt.Errorf("unknown action %q", req.Action)
+
+	case "preview":
+		text, ok, err := lens.Preview(ctx, l, entry)
+		if err != nil {
+			return err
+		}
+		send(response{Preview: text, HasPreview: ok})
+		return nil
+	}
+
+	return fmt.Errorf("unknown method %q", req.Method)
+}
+
+func (s *server) lens(name string) (lens.Lens, error) {
+	for _, l := range s.lenses {
+		if strings.EqualFold(l.Name(), name) {
+			return l, nil
+		}
+	}
+	if name == "" {
+		return nil, errors.New("no lens given")
+	}
+	return nil, fmt.Errorf("unknown lens %q", name)
+}
@@ -0,0 +1,72 @@
+package daemon
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// SocketPath returns where the daemon listens: in $XDG_RUNTIME_DIR if it's
+// set, and otherwise in a directory of the user's own in the temporary
+// directory, which other users share
+func SocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "spyglass.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("spyglass-%d", os.Getuid()), "spyglass.sock")
+}
+
+// listen creates the socket at path. Anyone who can connect to it can run
+// commands as the user, so it's made in a directory only the user can get
+// into, and only the user can use it from the moment it exists.
+func listen(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := checkOwned(dir, true); err != nil {
+		return nil, err
+	}
+
+	// Left behind by a daemon that didn't exit cleanly
+	_ = os.Remove(path)
+
+	old := syscall.Umask(0077)
+	ln, err := net.Listen("unix", path)
+	syscall.Umask(old)
+	return ln, err
+}
+
+// checkSocket fails unless path is a socket belonging to the user, so that
+// requests aren't sent to, and answered by, another user's program
+func checkSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s isn't a socket", path)
+	}
+	return checkOwned(path, false)
+}
+
+// checkOwned fails unless path belongs to the user, and, if private is set,
+// only the user can change what's in it
+func checkOwned(path string, private bool) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s belongs to another user", path)
+	}
+	if private && info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s can be written to by other users", path)
+	}
+	return nil
+}
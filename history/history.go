@@ -0,0 +1,156 @@
+// Package history remembers which entries were launched from each lens, so
+// that frequently and recently used entries can be ranked higher.
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Number of visits remembered per entry
+const maxVisits = 10
+
+// Entries not visited for this long are forgotten
+const forgetAfter = 365 * 24 * time.Hour
+
+type Store struct {
+	mu   sync.Mutex
+	path string
+
+	// Visit timestamps (unix seconds) by lens name, then entry ID
+	visits map[string]map[string][]int64
+}
+
+// Path returns the location of the history file
+func Path() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheDir, "spyglass", "history.json")
+}
+
+// Empty returns a history that starts out empty and is never saved
+func Empty() *Store {
+	return &Store{visits: make(map[string]map[string][]int64)}
+}
+
+// Load reads the history file. A missing or unreadable file gives an empty
+// history.
+func Load() *Store {
+	s := &Store{
+		path:   Path(),
+		visits: make(map[string]map[string][]int64),
+	}
+
+	if s.path == "" {
+		return s
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return s
+	}
+
+	var visits map[string]map[string][]int64
+	if err := json.Unmarshal(data, &visits); err != nil {
+		return s
+	}
+	if visits != nil {
+		s.visits = visits
+	}
+
+	return s
+}
+
+// Record remembers that an entry was launched now, and saves the history
+func (s *Store) Record(lensName, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := s.visits[lensName]
+	if entries == nil {
+		entries = make(map[string][]int64)
+		s.visits[lensName] = entries
+	}
+
+	visits := append(entries[id], time.Now().Unix())
+	if len(visits) > maxVisits {
+		visits = visits[len(visits)-maxVisits:]
+	}
+	entries[id] = visits
+
+	return s.save()
+}
+
+// Boost returns how much to add to an entry's score, based on how often and
+// how recently it was launched
+func (s *Store) Boost(lensName, id string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	boost := 0
+	for _, v := range s.visits[lensName][id] {
+		boost += weight(now.Sub(time.Unix(v, 0)))
+	}
+	return boost
+}
+
+// weight scores a single visit by its age, like Firefox's frecency buckets
+func weight(age time.Duration) int {
+	const day = 24 * time.Hour
+
+	switch {
+	case age < 4*day:
+		return 10
+	case age < 14*day:
+		return 7
+	case age < 31*day:
+		return 5
+	case age < 90*day:
+		return 3
+	}
+	return 1
+}
+
+// save writes the history file, dropping entries that haven't been visited
+// in a long time. s.mu must be held.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	cutoff := time.Now().Add(-forgetAfter).Unix()
+	for lensName, entries := range s.visits {
+		for id, visits := range entries {
+			if len(visits) == 0 || visits[len(visits)-1] < cutoff {
+				delete(entries, id)
+			}
+		}
+		if len(entries) == 0 {
+			delete(s.visits, lensName)
+		}
+	}
+
+	data, err := json.Marshal(s.visits)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that a crash can't leave a
+	// truncated history behind
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
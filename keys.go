@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/indium114/spyglass/config"
+
+	"github.com/charmbracelet/bubbles/key"
+)
+
+type keyMap struct {
+	Quit        key.Binding
+	NextLens    key.Binding
+	PrevLens    key.Binding
+	ContextMenu key.Binding
+	Up          key.Binding
+	Down        key.Binding
+	PageUp      key.Binding
+	PageDown    key.Binding
+	Home        key.Binding
+	End         key.Binding
+	Enter       key.Binding
+	EnterStay   key.Binding
+	Toggle      key.Binding
+	ToggleAll   key.Binding
+	Back        key.Binding
+	Help        key.Binding
+}
+
+func defaultKeyMap() keyMap {
+	return keyMap{
+		Quit: key.NewBinding(
+			key.WithKeys("ctrl+c"),
+			key.WithHelp("ctrl+c", "quit"),
+		),
+		NextLens: key.NewBinding(
+			key.WithKeys("tab", "ctrl+right"),
+			key.WithHelp("tab", "next lens"),
+		),
+		PrevLens: key.NewBinding(
+			key.WithKeys("ctrl+left"),
+			key.WithHelp("ctrl+←", "previous lens"),
+		),
+		ContextMenu: key.NewBinding(
+			key.WithKeys("shift+tab"),
+			key.WithHelp("shift+tab", "context menu"),
+		),
+		Up: key.NewBinding(
+			key.WithKeys("up", "ctrl+p", "ctrl+k"),
+			key.WithHelp("↑/ctrl+p", "up"),
+		),
+		Down: key.NewBinding(
+			key.WithKeys("down", "ctrl+n", "ctrl+j"),
+			key.WithHelp("↓/ctrl+n", "down"),
+		),
+		PageUp: key.NewBinding(
+			key.WithKeys("pgup"),
+			key.WithHelp("pgup", "page up"),
+		),
+		PageDown: key.NewBinding(
+			key.WithKeys("pgdown"),
+			key.WithHelp("pgdown", "page down"),
+		),
+		Home: key.NewBinding(
+			key.WithKeys("home"),
+			key.WithHelp("home", "first result"),
+		),
+		End: key.NewBinding(
+			key.WithKeys("end"),
+			key.WithHelp("end", "last result"),
+		),
+		Enter: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "open"),
+		),
+		EnterStay: key.NewBinding(
+			key.WithKeys("alt+enter"),
+			key.WithHelp("alt+enter", "open, stay open"),
+		),
+		Toggle: key.NewBinding(
+			key.WithKeys("ctrl+@"),
+			key.WithHelp("ctrl+space", "mark"),
+		),
+		ToggleAll: key.NewBinding(
+			key.WithKeys("alt+a"),
+			key.WithHelp("alt+a", "mark all"),
+		),
+		Back: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "back"),
+		),
+		Help: key.NewBinding(
+			key.WithKeys("f1"),
+			key.WithHelp("f1", "help"),
+		),
+	}
+}
+
+// bindings returns the key map's bindings by the action names used in the
+// config file
+func (k *keyMap) bindings() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"quit":          &k.Quit,
+		"next_lens":     &k.NextLens,
+		"previous_lens": &k.PrevLens,
+		"context_menu":  &k.ContextMenu,
+		"up":            &k.Up,
+		"down":          &k.Down,
+		"page_up":       &k.PageUp,
+		"page_down":     &k.PageDown,
+		"home":          &k.Home,
+		"end":           &k.End,
+		"enter":         &k.Enter,
+		"enter_stay":    &k.EnterStay,
+		"toggle":        &k.Toggle,
+		"toggle_all":    &k.ToggleAll,
+		"back":          &k.Back,
+		"help":          &k.Help,
+	}
+}
+
+// newKeyMap builds the key map from the defaults, with the keys for any
+// action in overrides replaced. An empty list of keys unbinds the action.
+func newKeyMap(overrides map[string][]string) (keyMap, error) {
+	km := defaultKeyMap()
+	bindings := km.bindings()
+
+	for action, keys := range overrides {
+		b, ok := bindings[action]
+		if !ok {
+			return km, fmt.Errorf("%s: unknown key binding action %q", config.Path(), action)
+		}
+
+		if len(keys) == 0 {
+			b.Unbind()
+			continue
+		}
+
+		b.SetKeys(keys...)
+		b.SetHelp(strings.Join(keys, "/"), b.Help().Desc)
+	}
+
+	return km, nil
+}
+
+func (k keyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Enter, k.NextLens, k.ContextMenu, k.Help}
+}
+
+func (k keyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down, k.PageUp, k.PageDown, k.Home, k.End},
+		{k.Enter, k.EnterStay, k.Toggle, k.ToggleAll, k.ContextMenu, k.NextLens, k.PrevLens},
+		{k.Back, k.Help, k.Quit},
+	}
+}
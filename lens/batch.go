@@ -0,0 +1,143 @@
+package lens
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// BatchEnterer is implemented by lenses that open several entries together,
+// rather than one at a time, like copying several glyphs at once
+type BatchEnterer interface {
+	EnterBatch(entries []Entry) error
+}
+
+// BatchAction is a context action run on several entries together
+type BatchAction struct {
+	Name  string
+	Run   func([]Entry) error
+	After After
+	// Asked before running, as for Action
+	Confirm string
+}
+
+// BatchActioner is implemented by lenses with context actions for several
+// entries together
+type BatchActioner interface {
+	BatchActions(entries []Entry) []BatchAction
+}
+
+// group is entries that came from the same lens
+type group struct {
+	lens    Lens
+	entries []Entry
+}
+
+// origins groups entries shown by l by the lens they came from, in the order
+// each lens first appears
+func origins(l Lens, entries []Entry) []group {
+	var groups []group
+	for _, entry := range entries {
+		origin, e := Origin(l, entry)
+
+		i := slices.IndexFunc(groups, func(g group) bool {
+			return g.lens == origin
+		})
+		if i < 0 {
+			groups = append(groups, group{lens: origin})
+			i = len(groups) - 1
+		}
+		groups[i].entries = append(groups[i].entries, e)
+	}
+	return groups
+}
+
+// EnterBatch opens entries shown by l. Lenses that can't open several of
+// their entries together open them one at a time.
+func EnterBatch(l Lens, entries []Entry) error {
+	var errs []error
+	for _, g := range origins(l, entries) {
+		if b, ok := g.lens.(BatchEnterer); ok {
+			errs = append(errs, b.EnterBatch(g.entries))
+			continue
+		}
+		for _, e := range g.entries {
+			errs = append(errs, g.lens.Enter(e))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// BatchActions returns the context actions for entries shown by l, which
+// are run on the entries they're given, also as shown by l. If the entries
+// all came from a BatchActioner, those are its batch actions. Otherwise
+// they're the actions every entry has, run on each in turn, apart from those
+// asking for input.
+func BatchActions(l Lens, entries []Entry) []BatchAction {
+	groups := origins(l, entries)
+	if len(groups) == 0 {
+		return nil
+	}
+
+	if b, ok := groups[0].lens.(BatchActioner); ok && len(groups) == 1 {
+		actions := b.BatchActions(groups[0].entries)
+		for i, a := range actions {
+			actions[i].Run = func(entries []Entry) error {
+				var errs []error
+				for _, g := range origins(l, entries) {
+					errs = append(errs, a.Run(g.entries))
+				}
+				return errors.Join(errs...)
+			}
+		}
+		return actions
+	}
+
+	// The actions every entry has, in the first entry's order
+	common := groups[0].lens.ContextActions(groups[0].entries[0])
+	for _, g := range groups {
+		for _, e := range g.entries {
+			own := g.lens.ContextActions(e)
+			common = slices.DeleteFunc(common, func(a Action) bool {
+				return !slices.ContainsFunc(own, func(b Action) bool { return b.Name == a.Name })
+			})
+		}
+	}
+
+	// Each entry would need its own input
+	common = slices.DeleteFunc(common, func(a Action) bool {
+		return a.Input != nil
+	})
+
+	actions := make([]BatchAction, len(common))
+	for i, a := range common {
+		name := a.Name
+		actions[i] = BatchAction{
+			Name:  name,
+			After: a.After,
+			Run: func(entries []Entry) error {
+				var errs []error
+				for _, g := range origins(l, entries) {
+					for _, e := range g.entries {
+						errs = append(errs, runAction(g.lens, e, name))
+					}
+				}
+				return errors.Join(errs...)
+			},
+		}
+		if a.Confirm != "" {
+			actions[i].Confirm = fmt.Sprintf("%s, for %d entries?", name, len(entries))
+		}
+	}
+	return actions
+}
+
+// runAction runs the context action called name on entry
+func runAction(l Lens, entry Entry, name string) error {
+	for _, a := range l.ContextActions(entry) {
+		if a.Name == name {
+			return a.Run(entry)
+		}
+	}
+	return fmt.Errorf("%s has no action %q for %s", l.Name(), name, entry.Title)
+}
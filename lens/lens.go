@@ -1,15 +1,80 @@
 package lens
 
+import (
+	"fmt"
+	"slices"
+)
+
 type Entry struct {
-	ID          string
-	Title       string
-	Icon        string
-	Description string
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Icon        string `json:"icon,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Relevance to the query, higher ranks first
+	Score int `json:"score"`
+	// Rune indexes of Title that matched the query, to be highlighted
+	Matches []int `json:"matches,omitempty"`
+	// Short label shown alongside the title, like the lens it came from
+	Badge string `json:"badge,omitempty"`
 }
 
 type Action struct {
 	Name string
 	Run  func(Entry) error
+	// What spyglass does once Run succeeds. Closing is the default.
+	After After
+	// A yes or no question asked before running, for actions that can't be
+	// undone, like "Move notes.txt to the trash?"
+	Confirm string
+	// Text asked for before running, like a new name. Input.Run is called
+	// with it in place of Run.
+	Input *Input
+}
+
+// Input is text asked for before an action runs
+type Input struct {
+	// Shown before the text, like "New name"
+	Prompt string
+	// The text to start with
+	Value string
+	Run   func(entry Entry, text string) error
+}
+
+// After is what spyglass does once an action has run
+type After int
+
+const (
+	// Close spyglass
+	AfterClose After = iota
+	// Search again, and go back to the results
+	AfterRefresh
+	// Keep the context menu open
+	AfterStay
+)
+
+var afterNames = []string{"close", "refresh", "stay"}
+
+func (a After) String() string {
+	if int(a) < len(afterNames) {
+		return afterNames[a]
+	}
+	return fmt.Sprintf("After(%d)", int(a))
+}
+
+// MarshalText writes a as close, refresh or stay, the way it's written in
+// config files and plugin messages
+func (a After) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *After) UnmarshalText(text []byte) error {
+	i := slices.Index(afterNames, string(text))
+	if i < 0 {
+		return fmt.Errorf("unknown after %q, expected close, refresh or stay", text)
+	}
+	*a = After(i)
+	return nil
 }
 
 type Lens interface {
@@ -18,3 +83,54 @@ type Lens interface {
 	Enter(entry Entry) error
 	ContextActions(entry Entry) []Action
 }
+
+// Resolver is implemented by lenses that show entries from other lenses.
+// Resolve returns the lens an entry came from, and the entry as that lens
+// produced it.
+type Resolver interface {
+	Resolve(entry Entry) (Lens, Entry, bool)
+}
+
+// Origin returns the lens that entry really belongs to, looking through
+// lenses that show entries from other lenses
+func Origin(l Lens, entry Entry) (Lens, Entry) {
+	for {
+		r, ok := l.(Resolver)
+		if !ok {
+			return l, entry
+		}
+
+		origin, e, ok := r.Resolve(entry)
+		if !ok {
+			return l, entry
+		}
+		l, entry = origin, e
+	}
+}
+
+// Keyworder is implemented by lenses that can be jumped to by typing a
+// keyword, like "f ", at the start of the query
+type Keyworder interface {
+	Keyword() string
+}
+
+// Configurable is implemented by lenses that read their own section of the
+// config file. decode unmarshals that section into v.
+type Configurable interface {
+	Configure(decode func(v any) error) error
+}
+
+// Refresher is implemented by lenses that keep data in memory, like an index.
+// The daemon calls Refresh in the background when it starts, and every so
+// often after, to load or update that data ahead of searches.
+type Refresher interface {
+	Refresh()
+}
+
+// Statuser is implemented by lenses that do slow work in the background,
+// like indexing. Status describes it, like "Indexed 120k files…", or is
+// empty when there's none. It's shown in the status line while the lens is
+// active.
+type Statuser interface {
+	Status() string
+}
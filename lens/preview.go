@@ -0,0 +1,25 @@
+package lens
+
+import "context"
+
+// Previewer is implemented by lenses that can show more about an entry than
+// its description, in a pane beside the results. Preview runs in the
+// background, and its result is cached, so it may be slow. The text may
+// contain ANSI escape codes for colour; lines wider than the pane are cut off.
+type Previewer interface {
+	Preview(ctx context.Context, entry Entry) (string, error)
+}
+
+// Preview returns the preview of entry from the lens it came from. ok is
+// false if that lens doesn't have previews.
+func Preview(ctx context.Context, l Lens, entry Entry) (text string, ok bool, err error) {
+	l, entry = Origin(l, entry)
+
+	p, ok := l.(Previewer)
+	if !ok {
+		return "", false, nil
+	}
+
+	text, err = p.Preview(ctx, entry)
+	return text, true, err
+}
@@ -0,0 +1,66 @@
+package lens
+
+import "context"
+
+// ContextSearcher is implemented by lenses whose searches can be cancelled.
+// SearchContext should return early (with ctx.Err()) once ctx is done.
+type ContextSearcher interface {
+	SearchContext(ctx context.Context, query string) ([]Entry, error)
+}
+
+// StreamSearcher is implemented by lenses that produce results incrementally.
+// SearchStream calls push with each new batch of entries as it becomes
+// available, and returns once the search is complete or ctx is done.
+type StreamSearcher interface {
+	SearchStream(ctx context.Context, query string, push func([]Entry)) error
+}
+
+// SearchContext runs a search on l, stopping when ctx is done.
+// Streaming lenses have their batches collected into a single slice.
+// Lenses that implement neither interface are run in their own goroutine,
+// and their results are dropped if ctx finishes first.
+func SearchContext(ctx context.Context, l Lens, query string) ([]Entry, error) {
+	if cs, ok := l.(ContextSearcher); ok {
+		return cs.SearchContext(ctx, query)
+	}
+
+	if ss, ok := l.(StreamSearcher); ok {
+		var entries []Entry
+		err := ss.SearchStream(ctx, query, func(batch []Entry) {
+			entries = append(entries, batch...)
+		})
+		return entries, err
+	}
+
+	type result struct {
+		entries []Entry
+		err     error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		entries, err := l.Search(query)
+		done <- result{entries, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-done:
+		return r.entries, r.err
+	}
+}
+
+// SearchStream runs a search on l, passing results to push as they arrive.
+// Lenses that don't stream deliver all of their results in one batch.
+func SearchStream(ctx context.Context, l Lens, query string, push func([]Entry)) error {
+	if ss, ok := l.(StreamSearcher); ok {
+		return ss.SearchStream(ctx, query, push)
+	}
+
+	entries, err := SearchContext(ctx, l, query)
+	if len(entries) > 0 {
+		push(entries)
+	}
+	return err
+}
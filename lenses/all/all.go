@@ -0,0 +1,171 @@
+package all
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/indium114/spyglass/lens"
+)
+
+// Name is the All lens's name
+const Name = "All"
+
+// Number of results shown from each lens
+const perLens = 10
+
+// Separates the originating lens's name from the entry ID
+const idSep = "\x1f"
+
+type allLens struct {
+	lenses []lens.Lens
+}
+
+// New returns a lens that searches all of lenses at once
+func New(lenses []lens.Lens) lens.Lens {
+	return &allLens{lenses: lenses}
+}
+
+func (a *allLens) Name() string {
+	return Name
+}
+
+func (a *allLens) Search(query string) ([]lens.Entry, error) {
+	return lens.SearchContext(context.Background(), a, query)
+}
+
+func (a *allLens) SearchStream(ctx context.Context, query string, push func([]lens.Entry)) error {
+	var (
+		wg     sync.WaitGroup
+		pushMu sync.Mutex
+		errs   []error
+	)
+
+	// Every lens is searched at once, and its best results are pushed as
+	// soon as it finishes, so slow lenses don't hold up fast ones
+	for _, l := range a.lenses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			entries, err := lens.SearchContext(ctx, l, query)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				pushMu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", l.Name(), err))
+				pushMu.Unlock()
+			}
+			if len(entries) == 0 {
+				return
+			}
+
+			slices.SortStableFunc(entries, func(a, b lens.Entry) int {
+				return cmp.Compare(b.Score, a.Score)
+			})
+			if len(entries) > perLens {
+				entries = entries[:perLens]
+			}
+
+			batch := make([]lens.Entry, len(entries))
+			for i, e := range entries {
+				e.ID = l.Name() + idSep + e.ID
+				e.Badge = l.Name()
+				batch[i] = e
+			}
+
+			pushMu.Lock()
+			defer pushMu.Unlock()
+			if ctx.Err() == nil {
+				push(batch)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// One broken lens doesn't stop the others' results from being shown
+	return errors.Join(errs...)
+}
+
+func (a *allLens) Resolve(e lens.Entry) (lens.Lens, lens.Entry, bool) {
+	name, id, ok := strings.Cut(e.ID, idSep)
+	if !ok {
+		return nil, e, false
+	}
+
+	for _, l := range a.lenses {
+		if l.Name() == name {
+			e.ID = id
+			e.Badge = ""
+			return l, e, true
+		}
+	}
+	return nil, e, false
+}
+
+func (a *allLens) Enter(e lens.Entry) error {
+	l, orig, ok := a.Resolve(e)
+	if !ok {
+		return fmt.Errorf("no lens for %q", e.ID)
+	}
+	return l.Enter(orig)
+}
+
+func (a *allLens) ContextActions(e lens.Entry) []lens.Action {
+	l, orig, ok := a.Resolve(e)
+	if !ok {
+		// Shown in place of the actions, and reported if it's run
+		err := fmt.Errorf("no lens for %q", e.ID)
+		return []lens.Action{{
+			Name:  "No actions: " + err.Error(),
+			After: lens.AfterStay,
+			Run: func(lens.Entry) error {
+				return err
+			},
+		}}
+	}
+
+	// Actions are run on the entry as the lens they came from produced it
+	original := func(entry lens.Entry) lens.Entry {
+		if _, orig, ok := a.Resolve(entry); ok {
+			return orig
+		}
+		return entry
+	}
+
+	actions := l.ContextActions(orig)
+	for i, action := range actions {
+		if run := action.Run; run != nil {
+			actions[i].Run = func(entry lens.Entry) error {
+				return run(original(entry))
+			}
+		}
+		if action.Input != nil {
+			input := *action.Input
+			run := input.Run
+			input.Run = func(entry lens.Entry, text string) error {
+				return run(original(entry), text)
+			}
+			actions[i].Input = &input
+		}
+	}
+	return actions
+}
+
+// Status reports what the first busy lens is doing, since searches wait for
+// it
+func (a *allLens) Status() string {
+	for _, l := range a.lenses {
+		if s, ok := l.(lens.Statuser); ok {
+			if text := s.Status(); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
@@ -1,6 +1,7 @@
 package applications
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -9,7 +10,9 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/indium114/spyglass/config"
 	"github.com/indium114/spyglass/lens"
+	"github.com/indium114/spyglass/match"
 
 	"gopkg.in/yaml.v3"
 )
@@ -20,17 +23,26 @@ type appConfig struct {
 	Command     string `yaml:"command"`
 	Description string `yaml:"description"`
 	Context     []struct {
-		Name    string `yaml:"name"`
-		Command string `yaml:"command"`
+		Name    string     `yaml:"name"`
+		Command string     `yaml:"command"`
+		After   lens.After `yaml:"after"`
 	} `yaml:"context"`
 }
 
+type settings struct {
+	// Directory the application files are read from
+	Dir string `yaml:"dir"`
+}
+
 type applicationsLens struct {
+	dir  string
 	apps []appConfig
 }
 
 func New() lens.Lens {
-	l := &applicationsLens{}
+	l := &applicationsLens{
+		dir: filepath.Join(config.Dir(), "applications"),
+	}
 	l.load()
 	return l
 }
@@ -39,14 +51,26 @@ func (a *applicationsLens) Name() string {
 	return "Applications"
 }
 
+func (a *applicationsLens) Configure(decode func(v any) error) error {
+	var s settings
+	if err := decode(&s); err != nil {
+		return err
+	}
+
+	if s.Dir != "" {
+		a.dir = config.ExpandHome(s.Dir)
+		a.load()
+	}
+	return nil
+}
+
 func (a *applicationsLens) load() {
-	home, _ := os.UserHomeDir()
-	dir := filepath.Join(home, ".config", "spyglass", "applications")
-	files, _ := os.ReadDir(dir)
+	a.apps = nil
+	files, _ := os.ReadDir(a.dir)
 
 	for _, f := range files {
 		if strings.HasSuffix(f.Name(), ".yaml") {
-			data, _ := os.ReadFile(filepath.Join(dir, f.Name()))
+			data, _ := os.ReadFile(filepath.Join(a.dir, f.Name()))
 			var cfg appConfig
 			yaml.Unmarshal(data, &cfg)
 			a.apps = append(a.apps, cfg)
@@ -56,21 +80,40 @@ func (a *applicationsLens) load() {
 
 func (a *applicationsLens) Search(query string) ([]lens.Entry, error) {
 	var results []lens.Entry
-	query = strings.ToLower(query)
 
 	for _, app := range a.apps {
-		if strings.Contains(strings.ToLower(app.Name), query) {
+		if score, matches, ok := match.Match(query, app.Name); ok {
 			results = append(results, lens.Entry{
 				ID:          app.Name,
 				Title:       app.Name,
 				Icon:        app.Icon,
 				Description: app.Description,
+				Score:       score,
+				Matches:     matches,
 			})
 		}
 	}
 	return results, nil
 }
 
+func (a *applicationsLens) Preview(ctx context.Context, entry lens.Entry) (string, error) {
+	for _, app := range a.apps {
+		if app.Name == entry.Title {
+			var b strings.Builder
+			fmt.Fprintf(&b, "Command\n  %s\n", app.Command)
+
+			if len(app.Context) > 0 {
+				b.WriteString("\nActions\n")
+				for _, c := range app.Context {
+					fmt.Fprintf(&b, "  %s: %s\n", c.Name, c.Command)
+				}
+			}
+			return b.String(), nil
+		}
+	}
+	return "", nil
+}
+
 func (a *applicationsLens) Enter(entry lens.Entry) error {
 	for _, app := range a.apps {
 		if app.Name == entry.Title {
@@ -116,7 +159,8 @@ func (a *applicationsLens) ContextActions(entry lens.Entry) []lens.Action {
 			for _, c := range app.Context {
 				command := c.Command
 				actions = append(actions, lens.Action{
-					Name: c.Name,
+					Name:  c.Name,
+					After: c.After,
 					Run: func(e lens.Entry) error {
 						cmd := exec.Command("sh", "-c", command)
 						cmd.Stdout = nil
@@ -3,11 +3,15 @@ package clipboard
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"fmt"
 	"os/exec"
 	"strings"
 	"syscall"
+	"unicode/utf8"
 
 	"github.com/indium114/spyglass/lens"
+	"github.com/indium114/spyglass/match"
 )
 
 type clipboardLens struct{}
@@ -21,7 +25,11 @@ func (l *clipboardLens) Name() string {
 }
 
 func (l *clipboardLens) Search(query string) ([]lens.Entry, error) {
-	cmd := exec.Command("cliphist", "list")
+	return l.SearchContext(context.Background(), query)
+}
+
+func (l *clipboardLens) SearchContext(ctx context.Context, query string) ([]lens.Entry, error) {
+	cmd := exec.CommandContext(ctx, "cliphist", "list")
 
 	out, err := cmd.Output()
 	if err != nil {
@@ -48,12 +56,14 @@ func (l *clipboardLens) Search(query string) ([]lens.Entry, error) {
 			text = text[:limit] + "..."
 		}
 
-		if query == "" || strings.Contains(strings.ToLower(text), strings.ToLower(query)) {
+		if score, matches, ok := match.Match(query, text); ok {
 			entries = append(entries, lens.Entry{
 				ID:          id,
 				Title:       text,
 				Icon:        "",
 				Description: "Entry ID " + id,
+				Score:       score,
+				Matches:     matches,
 			})
 		}
 	}
@@ -61,28 +71,25 @@ func (l *clipboardLens) Search(query string) ([]lens.Entry, error) {
 	return entries, nil
 }
 
-func (l *clipboardLens) Enter(e lens.Entry) error {
-	cmd := exec.Command("cliphist", "decode", e.ID)
-
-	copyCmd := exec.Command("wl-copy")
-	copyCmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
-
-	pipe, err := cmd.StdoutPipe()
+func (l *clipboardLens) Preview(ctx context.Context, e lens.Entry) (string, error) {
+	out, err := exec.CommandContext(ctx, "cliphist", "decode", e.ID).Output()
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	copyCmd.Stdin = pipe
-
-	if err := cmd.Start(); err != nil {
-		return err
+	if bytes.IndexByte(out, 0) >= 0 || !utf8.Valid(out) {
+		return fmt.Sprintf("Binary data, %d bytes", len(out)), nil
 	}
+	return string(out), nil
+}
 
-	if err := copyCmd.Start(); err != nil {
-		return err
-	}
+func (l *clipboardLens) Enter(e lens.Entry) error {
+	return copyEntries([]lens.Entry{e})
+}
 
-	return nil
+// EnterBatch copies the entries together, one per line
+func (l *clipboardLens) EnterBatch(entries []lens.Entry) error {
+	return copyEntries(entries)
 }
 
 func (l *clipboardLens) ContextActions(e lens.Entry) []lens.Action {
@@ -90,26 +97,19 @@ func (l *clipboardLens) ContextActions(e lens.Entry) []lens.Action {
 		{
 			Name: "Copy to Clipboard",
 			Run: func(entry lens.Entry) error {
-				cmd := exec.Command("cliphist", "decode", entry.ID)
-				copyCmd := exec.Command("wl-copy")
-				copyCmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
-
-				pipe, err := cmd.StdoutPipe()
-				if err != nil {
-					return err
-				}
-
-				copyCmd.Stdin = pipe
-
-				if err := cmd.Start(); err != nil {
-					return err
-				}
-
-				return copyCmd.Start()
+				return copyEntries([]lens.Entry{entry})
 			},
 		},
 		{
-			Name: "Clear History",
+			Name:  "Delete",
+			After: lens.AfterRefresh,
+			Run: func(entry lens.Entry) error {
+				return deleteEntries([]lens.Entry{entry})
+			},
+		},
+		{
+			Name:  "Clear History",
+			After: lens.AfterRefresh,
 			Run: func(entry lens.Entry) error {
 				cmd := exec.Command("cliphist", "wipe")
 				return cmd.Run()
@@ -117,3 +117,41 @@ func (l *clipboardLens) ContextActions(e lens.Entry) []lens.Action {
 		},
 	}
 }
+
+func (l *clipboardLens) BatchActions(entries []lens.Entry) []lens.BatchAction {
+	return []lens.BatchAction{
+		{Name: "Copy to Clipboard", Run: copyEntries},
+		{Name: "Delete", Run: deleteEntries, After: lens.AfterRefresh},
+	}
+}
+
+// copyEntries copies the entries' contents to the clipboard, one per line
+func copyEntries(entries []lens.Entry) error {
+	var contents [][]byte
+	for _, e := range entries {
+		out, err := exec.Command("cliphist", "decode", e.ID).Output()
+		if err != nil {
+			return err
+		}
+		contents = append(contents, out)
+	}
+
+	copyCmd := exec.Command("wl-copy")
+	copyCmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	copyCmd.Stdin = bytes.NewReader(bytes.Join(contents, []byte("\n")))
+
+	// wl-copy stays running to serve the clipboard, so don't wait for it
+	return copyCmd.Start()
+}
+
+// deleteEntries removes the entries from the clipboard history
+func deleteEntries(entries []lens.Entry) error {
+	var lines strings.Builder
+	for _, e := range entries {
+		lines.WriteString(e.ID + "\t" + e.Title + "\n")
+	}
+
+	cmd := exec.Command("cliphist", "delete")
+	cmd.Stdin = strings.NewReader(lines.String())
+	return cmd.Run()
+}
@@ -0,0 +1,65 @@
+// Package dmenu is the lens used by spyglass --dmenu, which picks from lines
+// read from standard input
+package dmenu
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/indium114/spyglass/lens"
+	"github.com/indium114/spyglass/match"
+)
+
+type dmenuLens struct {
+	items []string
+}
+
+// New returns a lens searching items. Each entry's ID is the index of its
+// item.
+func New(items []string) lens.Lens {
+	return &dmenuLens{items: items}
+}
+
+// Read reads newline-separated items, like dmenu does from standard input
+func Read(r io.Reader) ([]string, error) {
+	var items []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		items = append(items, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	return items, scanner.Err()
+}
+
+func (d *dmenuLens) Name() string {
+	return "dmenu"
+}
+
+func (d *dmenuLens) Search(query string) ([]lens.Entry, error) {
+	query = strings.TrimSpace(query)
+
+	var entries []lens.Entry
+	for i, item := range d.items {
+		if score, matches, ok := match.Match(query, item); ok {
+			entries = append(entries, lens.Entry{
+				ID:      strconv.Itoa(i),
+				Title:   item,
+				Score:   score,
+				Matches: matches,
+			})
+		}
+	}
+	return entries, nil
+}
+
+func (d *dmenuLens) Enter(entry lens.Entry) error {
+	// The chosen item is printed by spyglass itself
+	return nil
+}
+
+func (d *dmenuLens) ContextActions(entry lens.Entry) []lens.Action {
+	return nil
+}
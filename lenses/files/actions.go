@@ -0,0 +1,398 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/indium114/spyglass/lens"
+)
+
+// terminalApp is a terminal, with the arguments it needs before the command
+// to run in it
+type terminalApp struct {
+	name string
+	args []string
+}
+
+// Terminals tried in order when none is configured
+var terminals = []terminalApp{
+	{"xdg-terminal-exec", nil},
+	{"kitty", nil},
+	{"foot", nil},
+	{"alacritty", []string{"-e"}},
+	{"wezterm", []string{"start", "--"}},
+	{"ghostty", []string{"-e"}},
+	{"gnome-terminal", []string{"--"}},
+	{"konsole", []string{"-e"}},
+	{"xfce4-terminal", []string{"-x"}},
+	{"xterm", []string{"-e"}},
+}
+
+// Opens files in $VISUAL or $EDITOR, as given after it
+const editorScript = `exec ${VISUAL:-${EDITOR:-vi}} "$@"`
+
+func (l *filesLens) ContextActions(e lens.Entry) []lens.Action {
+	path := e.ID
+	info, err := os.Stat(path)
+	if err != nil {
+		// Gone since it was indexed
+		return []lens.Action{l.reindexAction()}
+	}
+
+	var actions []lens.Action
+	for _, app := range applicationsFor(mimeTypeOf(path, info)) {
+		actions = append(actions, lens.Action{
+			Name: "Open with " + app.name,
+			Run: func(e lens.Entry) error {
+				return l.launch(app.command(e.ID), app.terminal)
+			},
+		})
+	}
+
+	actions = append(actions, lens.Action{
+		Name: "Open Containing Folder",
+		Run: func(e lens.Entry) error {
+			return l.showInFolder(e.ID)
+		},
+	})
+	if !info.IsDir() {
+		actions = append(actions, lens.Action{
+			Name: "Open in Editor",
+			Run: func(e lens.Entry) error {
+				return l.edit([]string{e.ID})
+			},
+		})
+	}
+
+	actions = append(actions,
+		lens.Action{
+			Name: "Copy Path",
+			Run: func(e lens.Entry) error {
+				return copyText(e.ID)
+			},
+		},
+		lens.Action{
+			Name: "Copy URI",
+			Run: func(e lens.Entry) error {
+				return copyText(fileURI(e.ID))
+			},
+		},
+	)
+	if info.Mode().IsRegular() {
+		actions = append(actions, lens.Action{
+			Name: "Copy Contents",
+			Run: func(e lens.Entry) error {
+				return copyFile(e.ID)
+			},
+		})
+	}
+
+	dir := filepath.Dir(path)
+	short, _ := shortenPath(l.home, dir)
+	actions = append(actions,
+		lens.Action{
+			Name:  "Rename…",
+			After: lens.AfterRefresh,
+			Input: &lens.Input{
+				Prompt: "Rename to",
+				Value:  filepath.Base(path),
+				Run:    l.rename,
+			},
+		},
+		lens.Action{
+			Name:  "New File…",
+			After: lens.AfterRefresh,
+			Input: &lens.Input{
+				Prompt: "New file in " + short,
+				Run: func(e lens.Entry, name string) error {
+					return l.create(filepath.Dir(e.ID), name, false)
+				},
+			},
+		},
+		lens.Action{
+			Name:  "New Directory…",
+			After: lens.AfterRefresh,
+			Input: &lens.Input{
+				Prompt: "New directory in " + short,
+				Run: func(e lens.Entry, name string) error {
+					return l.create(filepath.Dir(e.ID), name, true)
+				},
+			},
+		},
+		lens.Action{
+			Name:    "Move to Trash",
+			After:   lens.AfterRefresh,
+			Confirm: fmt.Sprintf("Move %s to the trash?", filepath.Base(path)),
+			Run: func(e lens.Entry) error {
+				return l.trashPaths([]string{e.ID})
+			},
+		},
+		l.reindexAction(),
+	)
+	return actions
+}
+
+// BatchActions returns the actions for several files at once
+func (l *filesLens) BatchActions(entries []lens.Entry) []lens.BatchAction {
+	return []lens.BatchAction{
+		{
+			Name: "Open in Editor",
+			Run: func(entries []lens.Entry) error {
+				return l.edit(entryPaths(entries))
+			},
+		},
+		{
+			Name: "Copy Paths",
+			Run: func(entries []lens.Entry) error {
+				return copyText(strings.Join(entryPaths(entries), "\n"))
+			},
+		},
+		{
+			Name: "Copy URIs",
+			Run: func(entries []lens.Entry) error {
+				uris := make([]string, len(entries))
+				for i, e := range entries {
+					uris[i] = fileURI(e.ID)
+				}
+				return copyText(strings.Join(uris, "\n"))
+			},
+		},
+		{
+			Name:    "Move to Trash",
+			After:   lens.AfterRefresh,
+			Confirm: fmt.Sprintf("Move %d files to the trash?", len(entries)),
+			Run: func(entries []lens.Entry) error {
+				return l.trashPaths(entryPaths(entries))
+			},
+		},
+		{
+			Name:  "Reindex Files",
+			After: lens.AfterRefresh,
+			Run: func([]lens.Entry) error {
+				return l.reindexAction().Run(lens.Entry{})
+			},
+		},
+	}
+}
+
+func (l *filesLens) reindexAction() lens.Action {
+	return lens.Action{
+		Name:  "Reindex Files",
+		After: lens.AfterRefresh,
+		Run: func(lens.Entry) error {
+			l.load()
+			l.reindex(true)
+			return nil
+		},
+	}
+}
+
+// entryPaths returns the paths of entries
+func entryPaths(entries []lens.Entry) []string {
+	paths := make([]string, len(entries))
+	for i, e := range entries {
+		paths[i] = e.ID
+	}
+	return paths
+}
+
+// launch runs a command in the background, in a terminal if asked
+func (l *filesLens) launch(args []string, inTerminal bool) error {
+	if inTerminal {
+		var err error
+		if args, err = l.terminalCommand(args); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		_ = cmd.Wait()
+	}()
+	return nil
+}
+
+// terminalCommand returns the command line running args in a new terminal:
+// the configured one, $TERMINAL, or the first installed of terminals
+func (l *filesLens) terminalCommand(args []string) ([]string, error) {
+	if len(l.terminal) > 0 {
+		return slices.Concat(l.terminal, args), nil
+	}
+
+	argsFor := func(name string) []string {
+		i := slices.IndexFunc(terminals, func(t terminalApp) bool {
+			return t.name == filepath.Base(name)
+		})
+		if i < 0 {
+			return []string{"-e"}
+		}
+		return terminals[i].args
+	}
+
+	if t := strings.Fields(os.Getenv("TERMINAL")); len(t) > 0 {
+		return slices.Concat(t, argsFor(t[0]), args), nil
+	}
+	for _, t := range terminals {
+		if _, err := exec.LookPath(t.name); err == nil {
+			return slices.Concat([]string{t.name}, t.args, args), nil
+		}
+	}
+	return nil, errors.New("no terminal found, set one with terminal in the files lens settings")
+}
+
+// edit opens paths in the editor, in a terminal
+func (l *filesLens) edit(paths []string) error {
+	return l.launch(slices.Concat([]string{"sh", "-c", editorScript, "sh"}, paths), true)
+}
+
+// showInFolder opens the directory path is in, with path selected if the
+// file manager supports it
+func (l *filesLens) showInFolder(path string) error {
+	// Commas would split the URI into several
+	if uri := fileURI(path); !strings.Contains(uri, ",") {
+		cmd := exec.Command("dbus-send", "--session", "--print-reply", "--reply-timeout=2000",
+			"--dest=org.freedesktop.FileManager1", "/org/freedesktop/FileManager1",
+			"org.freedesktop.FileManager1.ShowItems", "array:string:"+uri, "string:")
+		if cmd.Run() == nil {
+			return nil
+		}
+	}
+	return l.launch([]string{"xdg-open", filepath.Dir(path)}, false)
+}
+
+// rename gives the file at e a new name, in the same directory
+func (l *filesLens) rename(e lens.Entry, name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	to := filepath.Join(filepath.Dir(e.ID), name)
+	if to == e.ID {
+		return nil
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("%s already exists", name)
+	}
+
+	if err := os.Rename(e.ID, to); err != nil {
+		return err
+	}
+	l.moved(e.ID, to)
+	return nil
+}
+
+// create makes a new empty file or directory called name in dir
+func (l *filesLens) create(dir, name string, isDir bool) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, name)
+	if isDir {
+		if err := os.Mkdir(path, 0755); err != nil {
+			return err
+		}
+	} else {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+
+	l.moved("", path)
+	return nil
+}
+
+// trashPaths moves paths to the trash
+func (l *filesLens) trashPaths(paths []string) error {
+	var errs []error
+	for _, path := range paths {
+		if err := trash(path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		l.moved(path, "")
+	}
+	return errors.Join(errs...)
+}
+
+// checkName reports what's wrong with name as the name of a file, if
+// anything
+func checkName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("no name given")
+	case name == "." || name == "..":
+		return fmt.Errorf("%q can't be used as a name", name)
+	case strings.ContainsRune(name, filepath.Separator):
+		return fmt.Errorf("a name can't contain %q", filepath.Separator)
+	}
+	return nil
+}
+
+// fileURI returns the file:// URI of path
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// copyText copies text to the clipboard
+func copyText(text string) error {
+	return copyFrom(strings.NewReader(text), "")
+}
+
+// copyFile copies the contents of the file at path to the clipboard
+func copyFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Text is left for the clipboard tool to offer as every text type,
+	// rather than only its own, which many programs wouldn't paste
+	mimeType := mimeTypeOf(path, info)
+	if strings.HasPrefix(mimeType, "text/") {
+		mimeType = ""
+	}
+	return copyFrom(f, mimeType)
+}
+
+// copyFrom copies what r holds to the clipboard, as mimeType if it's given
+func copyFrom(r io.Reader, mimeType string) error {
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath("wl-copy"); err == nil {
+		cmd = exec.Command("wl-copy")
+		if mimeType != "" {
+			cmd.Args = append(cmd.Args, "--type", mimeType)
+		}
+	} else if _, err := exec.LookPath("xclip"); err == nil {
+		cmd = exec.Command("xclip", "-selection", "clipboard")
+		if mimeType != "" {
+			cmd.Args = append(cmd.Args, "-t", mimeType)
+		}
+	} else if _, err := exec.LookPath("pbcopy"); err == nil {
+		cmd = exec.Command("pbcopy")
+	} else {
+		return errors.New("no clipboard tool found, install wl-clipboard or xclip")
+	}
+
+	cmd.Stdin = r
+	return cmd.Run()
+}
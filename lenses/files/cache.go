@@ -0,0 +1,299 @@
+package files
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The index is saved between runs in a binary format:
+//
+//	magic, then the format version as a uvarint
+//	settings key: uvarint length, then bytes
+//	record count: uvarint
+//	records, each:
+//	  bytes of the path shared with the previous record's: uvarint
+//	  the rest of the path: uvarint length, then bytes
+//	  flags: byte
+//	  for walked directories only:
+//	    modification time, in nanoseconds: varint
+//	    rules time: varint
+//
+// Paths are written in the order they were walked, so neighbours share most
+// of their paths.
+const (
+	cacheMagic   = "spyglass files\n"
+	cacheVersion = 2
+)
+
+// Record flags
+const (
+	flagDir = 1 << iota
+	flagExcluded
+	flagWalked
+)
+
+// Longest path accepted when loading, to fail quickly on a corrupt file
+const maxCachedPath = 1 << 16
+
+// How long after it was last written a temporary file is taken to be left
+// over from a save that didn't finish
+const staleTemp = 10 * time.Minute
+
+// Only one save runs at a time
+var saveMu sync.Mutex
+
+func (l *filesLens) cachePath() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheDir, "spyglass", "files", "index")
+}
+
+// loadCache loads the saved index, unless it was saved with other settings,
+// like other roots
+func (l *filesLens) loadCache() {
+	path := l.cachePath()
+	if path == "" {
+		return
+	}
+	removeStaleTemps(filepath.Dir(path))
+
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	key := l.settingsKey()
+	files, err := readCache(bufio.NewReader(f), key)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	l.files = files
+	l.indexedWith = key
+	l.mu.Unlock()
+}
+
+// removeStaleTemps removes the temporary files of saves that never finished,
+// like when spyglass was killed part way through. Recent ones may belong to a
+// save still running in another process.
+func removeStaleTemps(dir string) {
+	temps, _ := filepath.Glob(filepath.Join(dir, "index-*"))
+	for _, temp := range temps {
+		if info, err := os.Stat(temp); err == nil && time.Since(info.ModTime()) > staleTemp {
+			_ = os.Remove(temp)
+		}
+	}
+}
+
+// readCache decodes an index saved with the settings key
+func readCache(r *bufio.Reader, key string) ([]record, error) {
+	magic := make([]byte, len(cacheMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != cacheMagic {
+		return nil, errors.New("not an index")
+	}
+
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if version != cacheVersion {
+		return nil, fmt.Errorf("index version %d, expected %d", version, cacheVersion)
+	}
+
+	saved, err := readString(r, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if saved != key {
+		return nil, errors.New("index saved with other settings")
+	}
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// The count comes from the file, so don't trust it too far
+	files := make([]record, 0, min(count, 1<<20))
+	var prev []byte
+	for range count {
+		shared, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if shared > uint64(len(prev)) {
+			return nil, errors.New("corrupt index")
+		}
+
+		path, err := readString(r, prev, int(shared))
+		if err != nil {
+			return nil, err
+		}
+		prev = []byte(path)
+
+		flags, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		rec := record{
+			Path:     path,
+			Dir:      flags&flagDir != 0,
+			Excluded: flags&flagExcluded != 0,
+			Walked:   flags&flagWalked != 0,
+		}
+		if rec.Walked {
+			if rec.ModTime, err = binary.ReadVarint(r); err != nil {
+				return nil, err
+			}
+			if rec.RulesTime, err = binary.ReadVarint(r); err != nil {
+				return nil, err
+			}
+		}
+		files = append(files, rec)
+	}
+	return files, nil
+}
+
+// readString reads a length and that many bytes, appended to the first
+// shared bytes of prefix
+func readString(r *bufio.Reader, prefix []byte, shared int) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if n > maxCachedPath {
+		return "", errors.New("corrupt index")
+	}
+
+	buf := make([]byte, shared+int(n))
+	copy(buf, prefix[:shared])
+	if _, err := io.ReadFull(r, buf[shared:]); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// save saves the index in the background, unless the lens has been closed
+func (l *filesLens) save(key string, files []record) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ctx.Err() != nil {
+		return
+	}
+
+	l.running.Add(1)
+	go func() {
+		defer l.running.Done()
+		l.saveCache(key, files)
+	}()
+}
+
+// saveCache saves the index, replacing the saved one only once it's been
+// written in full
+func (l *filesLens) saveCache(key string, files []record) {
+	path := l.cachePath()
+	if path == "" {
+		return
+	}
+
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	dir := filepath.Dir(path)
+	_ = os.MkdirAll(dir, 0755)
+
+	f, err := os.CreateTemp(dir, "index-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+
+	// Written to disk before it replaces the saved index, so that a crash
+	// can't leave an empty or partial index in its place
+	w := bufio.NewWriter(f)
+	writeCache(w, key, files)
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return
+	}
+	if err := f.Close(); err != nil {
+		return
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		log.Println("files: saving the index:", err)
+		return
+	}
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+
+	// Left behind by versions that saved the index as JSON
+	_ = os.Remove(filepath.Join(dir, "index.json"))
+}
+
+// writeCache encodes the index. Errors are left for the writer's Flush to
+// report.
+func writeCache(w *bufio.Writer, key string, files []record) {
+	var buf [binary.MaxVarintLen64]byte
+	uvarint := func(v uint64) {
+		w.Write(binary.AppendUvarint(buf[:0], v))
+	}
+	varint := func(v int64) {
+		w.Write(binary.AppendVarint(buf[:0], v))
+	}
+
+	w.WriteString(cacheMagic)
+	uvarint(cacheVersion)
+	uvarint(uint64(len(key)))
+	w.WriteString(key)
+	uvarint(uint64(len(files)))
+
+	prev := ""
+	for _, r := range files {
+		shared := 0
+		for shared < len(prev) && shared < len(r.Path) && prev[shared] == r.Path[shared] {
+			shared++
+		}
+		uvarint(uint64(shared))
+		uvarint(uint64(len(r.Path) - shared))
+		w.WriteString(r.Path[shared:])
+		prev = r.Path
+
+		var flags byte
+		if r.Dir {
+			flags |= flagDir
+		}
+		if r.Excluded {
+			flags |= flagExcluded
+		}
+		if r.Walked {
+			flags |= flagWalked
+		}
+		w.WriteByte(flags)
+		if r.Walked {
+			varint(r.ModTime)
+			varint(r.RulesTime)
+		}
+	}
+}
@@ -1,39 +1,139 @@
 package files
 
 import (
-	"encoding/json"
-	"io/fs"
+	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 
+	"github.com/indium114/spyglass/config"
 	"github.com/indium114/spyglass/lens"
+	"github.com/indium114/spyglass/match"
 )
 
+type settings struct {
+	// Chroma style used to highlight previews
+	Highlight string `yaml:"highlight"`
+
+	// Directories to index
+	Roots []string `yaml:"roots"`
+	// Patterns, written like .gitignore lines relative to each root, of
+	// paths to index and paths to leave out
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+	// How many directories deep to index below each root, or 0 for no limit
+	MaxDepth int `yaml:"max_depth"`
+	// Walk directories whose names start with a dot. Files starting with a
+	// dot are always indexed.
+	Hidden bool `yaml:"hidden"`
+	// Leave out what .gitignore, .ignore and .fdignore files list
+	IgnoreFiles bool `yaml:"ignore_files"`
+	// How many directories to watch for changes, or 0 not to watch any
+	MaxWatches int `yaml:"max_watches"`
+	// How many directories to read at once, or 0 for one per CPU
+	Workers int `yaml:"workers"`
+	// Walk into directories that symlinks lead to
+	FollowSymlinks bool `yaml:"follow_symlinks"`
+	// Types of filesystem not to walk below where they're mounted
+	SkipFilesystems []string `yaml:"skip_filesystems"`
+	// Command that runs the command after it in a new terminal, like
+	// [alacritty, -e]
+	Terminal []string `yaml:"terminal"`
+}
+
+// Paths left out of the index, unless exclude is configured
+var defaultExclude = []string{"node_modules/", "__pycache__/", "go/pkg/mod/"}
+
+// Network and FUSE filesystems, which are slow to walk and may hang, unless
+// skip_filesystems is configured
+var defaultSkipFilesystems = []string{
+	"nfs", "nfs4", "cifs", "smb3", "smbfs", "afpfs", "webdav", "davfs", "9p", "afs", "ceph", "glusterfs",
+	"fuse", "fuseblk", "macfuse", "osxfuse",
+}
+
 type filesLens struct {
 	home string
 
-	mu    sync.RWMutex
-	files []string
+	// Chroma style used to highlight previews
+	highlight string
+
+	// What to index
+	roots       []string
+	include     []string
+	exclude     []string
+	maxDepth    int
+	hidden      bool
+	ignoreFiles bool
+	maxWatches  int
+
+	workers         int
+	followSymlinks  bool
+	skipFilesystems []string
+
+	// Runs commands in a terminal. Found when needed if not set.
+	terminal []string
+
+	// Cancelled by Close, stopping walks
+	ctx  context.Context
+	stop context.CancelFunc
+	// Walks and saves in progress, which Close waits for so that the index
+	// is saved before spyglass exits. Only added to with mu held and ctx not
+	// yet cancelled.
+	running sync.WaitGroup
 
+	mu    sync.RWMutex
+	files []record
+	// The settingsKey files was indexed with
+	indexedWith string
+	// Keeps files up to date between walks, if the platform allows
+	watcher watcher
+
+	// Loads the cache and starts indexing on the first search
+	start    sync.Once
 	indexing bool
+	// Set while a first walk, with no cached index to search, publishes
+	// what it has found so far
+	partial bool
+	// The walk in progress, for reporting how far it's got
+	walking *walker
+	// Changes the watcher saw during the walk, applied once it's done
+	queued batch
+
+	// updated is closed (and replaced) whenever files grows or is replaced,
+	// waking up searches that are streaming from an index in progress
+	updated chan struct{}
+	// version changes whenever files is replaced rather than extended
+	version int
 }
 
+// Number of paths walked between publishing a partial index
+const publishEvery = 4096
+
+// Number of matches sent to the UI at a time
+const batchSize = 256
+
 func New() lens.Lens {
 	home, _ := os.UserHomeDir()
+	ctx, stop := context.WithCancel(context.Background())
 
 	l := &filesLens{
-		home: home,
+		home:            home,
+		highlight:       defaultHighlight,
+		exclude:         defaultExclude,
+		ignoreFiles:     true,
+		maxWatches:      defaultMaxWatches,
+		skipFilesystems: defaultSkipFilesystems,
+		ctx:             ctx,
+		stop:            stop,
+		updated:         make(chan struct{}),
 	}
-
-	l.loadCache()
-
 	if home != "" {
-		go l.index()
+		l.roots = []string{home}
 	}
-
 	return l
 }
 
@@ -41,104 +141,332 @@ func (l *filesLens) Name() string {
 	return "Files"
 }
 
-func (l *filesLens) cachePath() string {
-	cacheDir, err := os.UserCacheDir()
-	if err != nil {
-		return ""
-	}
-	return filepath.Join(cacheDir, "spyglass", "files", "index.json")
+func (l *filesLens) Keyword() string {
+	return "f "
 }
 
-func (l *filesLens) loadCache() {
-	path := l.cachePath()
-	if path == "" {
-		return
+func (l *filesLens) Configure(decode func(v any) error) error {
+	s := settings{
+		Exclude:         l.exclude,
+		IgnoreFiles:     l.ignoreFiles,
+		MaxWatches:      l.maxWatches,
+		SkipFilesystems: l.skipFilesystems,
+	}
+	if err := decode(&s); err != nil {
+		return err
 	}
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return
+	if s.Highlight != "" {
+		l.highlight = s.Highlight
 	}
 
-	var files []string
-	if err := json.Unmarshal(data, &files); err != nil {
-		return
+	if len(s.Roots) > 0 {
+		l.roots = nil
+		for _, root := range s.Roots {
+			root = filepath.Clean(config.ExpandHome(root))
+			if !filepath.IsAbs(root) {
+				return fmt.Errorf("root %q isn't an absolute path", root)
+			}
+			l.roots = append(l.roots, root)
+		}
 	}
 
-	l.mu.Lock()
-	l.files = files
-	l.mu.Unlock()
+	for _, p := range slices.Concat(s.Include, s.Exclude) {
+		if !validPattern(p) {
+			return fmt.Errorf("bad pattern %q", p)
+		}
+	}
+
+	l.include = s.Include
+	l.exclude = s.Exclude
+	l.maxDepth = s.MaxDepth
+	l.hidden = s.Hidden
+	l.ignoreFiles = s.IgnoreFiles
+	l.maxWatches = s.MaxWatches
+	l.workers = s.Workers
+	l.followSymlinks = s.FollowSymlinks
+	l.skipFilesystems = s.SkipFilesystems
+	l.terminal = s.Terminal
+	return nil
+}
+
+// load reads the cached index and starts refreshing it. It's put off until
+// the lens is first searched, so running spyglass for something else
+// doesn't walk the roots.
+func (l *filesLens) load() {
+	l.start.Do(func() {
+		l.loadCache()
+		l.reindex(false)
+	})
+}
+
+// Refresh loads the index if it hasn't been, and walks the roots again to
+// update it
+func (l *filesLens) Refresh() {
+	l.load()
+	l.reindex(false)
 }
 
-func (l *filesLens) saveCache(files []string) {
-	path := l.cachePath()
-	if path == "" {
+// reindex starts walking the roots in the background, unless a walk is
+// already running. Unless full is set, directories that haven't changed
+// since the last walk aren't read again.
+func (l *filesLens) reindex(full bool) {
+	if len(l.roots) == 0 {
 		return
 	}
 
-	_ = os.MkdirAll(filepath.Dir(path), 0755)
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	data, err := json.Marshal(files)
-	if err != nil {
+	// Checked with l.mu held, so that Close doesn't miss the walk
+	if l.indexing || l.ctx.Err() != nil {
 		return
 	}
+	l.indexing = true
 
-	_ = os.WriteFile(path, data, 0644)
+	// Without a cached index, publish paths as they are found so that
+	// searches have something to show during the first walk
+	var previous []record
+	key := l.settingsKey()
+	if !full && l.indexedWith == key {
+		previous = l.files
+	}
+	l.partial = len(l.files) == 0
+
+	l.running.Add(1)
+	go func() {
+		defer l.running.Done()
+		l.index(key, previous, l.partial)
+	}()
 }
 
-func (l *filesLens) index() {
+// index walks the roots, reusing what's still right in previous, and
+// makes the result the index
+func (l *filesLens) index(key string, previous []record, partial bool) {
+	var newFiles []record
+	published := 0
+
+	w := newWalker(l.ctx, l, previous, func(records []record) {
+		newFiles = append(newFiles, records...)
+		if partial && len(newFiles)-published >= publishEvery {
+			published = len(newFiles)
+			l.mu.Lock()
+			l.publish(newFiles, false)
+			l.mu.Unlock()
+		}
+	})
+
+	l.mu.Lock()
+	l.walking = w
+	l.mu.Unlock()
+
+	w.walk()
+
 	l.mu.Lock()
-	if l.indexing {
+	l.indexing = false
+	l.partial = false
+	l.walking = nil
+	if l.ctx.Err() != nil {
+		// Closed part way through, so the walk is incomplete
 		l.mu.Unlock()
 		return
 	}
-	l.indexing = true
+	l.indexedWith = key
+	l.publish(newFiles, !partial)
+	queued := l.queued
+	l.queued = batch{}
 	l.mu.Unlock()
 
-	var newFiles []string
+	l.watch(w.dirs)
+	l.saveCache(key, newFiles)
 
-	filepath.WalkDir(l.home, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return nil
-		}
+	if len(queued.changes) > 0 || queued.lost {
+		l.applyChanges(queued.changes, queued.lost)
+	}
+}
+
+// Status reports how far a walk of the roots has got, while one is running
+func (l *filesLens) Status() string {
+	l.mu.RLock()
+	indexing, w := l.indexing, l.walking
+	l.mu.RUnlock()
+
+	if !indexing {
+		return ""
+	}
+
+	var found int64
+	if w != nil {
+		found = w.found.Load()
+	}
+	return fmt.Sprintf("Indexed %s files…", formatCount(found))
+}
+
+// formatCount shortens large numbers, like 120k
+func formatCount(n int64) string {
+	switch {
+	case n < 1000:
+		return fmt.Sprint(n)
+	case n < 1000000:
+		return fmt.Sprintf("%dk", n/1000)
+	default:
+		return fmt.Sprintf("%.1fM", float64(n)/1000000)
+	}
+}
+
+// Close stops walking the roots and watching for changes, and waits for the
+// index to be saved
+func (l *filesLens) Close() error {
+	l.stop()
+
+	l.mu.Lock()
+	w := l.watcher
+	l.watcher = nil
+	l.mu.Unlock()
+
+	if w != nil {
+		w.close()
+	}
+
+	l.running.Wait()
+	return nil
+}
 
-		if d.IsDir() && strings.HasPrefix(d.Name(), ".") && path != l.home {
-			return filepath.SkipDir
+// moved updates the index for a path an action moved from one place to
+// another, without waiting for the watcher or the next walk. Paths that were
+// created have no from, and those removed no to.
+func (l *filesLens) moved(from, to string) {
+	var created []record
+	if from == "" {
+		info, err := os.Lstat(to)
+		if err != nil {
+			return
 		}
+		created = append(created, newRecord(to, info.IsDir()))
+	}
 
-		newFiles = append(newFiles, path)
-		return nil
-	})
+	prefix := from + string(filepath.Separator)
 
 	l.mu.Lock()
-	l.files = newFiles
-	l.indexing = false
+	updated := make([]record, 0, len(l.files)+len(created))
+	for _, r := range l.files {
+		if from != "" && (r.Path == from || strings.HasPrefix(r.Path, prefix)) {
+			if to == "" {
+				continue
+			}
+			r.Path = to + r.Path[len(from):]
+		}
+		updated = append(updated, r)
+	}
+	updated = append(updated, created...)
+
+	l.publish(updated, true)
+	key := l.indexedWith
 	l.mu.Unlock()
 
-	go l.saveCache(newFiles)
+	l.save(key, updated)
+}
+
+// publish makes files the current index. replaced should be set when files
+// is not an extension of the previous index. l.mu must be held.
+func (l *filesLens) publish(files []record, replaced bool) {
+	l.files = files
+	if replaced {
+		l.version++
+	}
+	close(l.updated)
+	l.updated = make(chan struct{})
 }
 
 func (l *filesLens) Search(query string) ([]lens.Entry, error) {
+	return lens.SearchContext(context.Background(), l, query)
+}
+
+func (l *filesLens) SearchStream(ctx context.Context, query string, push func([]lens.Entry)) error {
+	l.load()
+
+	query = strings.TrimSpace(query)
+	prefix := l.home + string(os.PathSeparator)
+
 	l.mu.RLock()
-	filesCopy := make([]string, len(l.files))
-	copy(filesCopy, l.files)
+	version := l.version
 	l.mu.RUnlock()
 
-	query = strings.ToLower(strings.TrimSpace(query))
-
-	var results []lens.Entry
-	for _, path := range filesCopy {
-		if query == "" || strings.Contains(strings.ToLower(path), query) {
-			results = append(results, lens.Entry{
-				ID:          path,
-				Title:       shortenPath(l.home, path),
-				Icon:        "󰈔",
-				Description: path,
-			})
+	var batch []lens.Entry
+	scanned := 0
+
+	for {
+		l.mu.RLock()
+		files, partial, updated := l.files, l.partial, l.updated
+		replaced := l.version != version
+		l.mu.RUnlock()
+
+		// Results from the old index have already been sent
+		if replaced {
+			return nil
+		}
+
+		for ; scanned < len(files); scanned++ {
+			// Check for cancellation every so often, the index can be huge
+			if scanned%1024 == 0 && ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			r := files[scanned]
+			if r.Excluded {
+				continue
+			}
+			path := r.Path
+
+			// Match against the path relative to home, so that the home
+			// directory itself doesn't match every query
+			rel := strings.TrimPrefix(path, prefix)
+			if score, positions, ok := match.Match(query, rel); ok {
+				title, where := shortenPath(l.home, path)
+
+				// Highlight the matches that survived shortening
+				offset := len([]rune(path)) - len([]rune(rel))
+				var matches []int
+				for _, p := range positions {
+					if w := where[offset+p]; w >= 0 {
+						matches = append(matches, w)
+					}
+				}
+
+				batch = append(batch, lens.Entry{
+					ID:          path,
+					Title:       title,
+					Icon:        "󰈔",
+					Description: path,
+					Score:       score,
+					Matches:     matches,
+				})
+			}
+
+			if len(batch) >= batchSize {
+				push(batch)
+				batch = nil
+			}
+		}
+
+		if len(batch) > 0 {
+			push(batch)
+			batch = nil
 		}
-	}
 
-	return results, nil
+		// A walk updating a cached index only publishes once it's done,
+		// so there's nothing more to wait for
+		if !partial {
+			return nil
+		}
+
+		// Wait for the first walk to find more files
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-updated:
+		}
+	}
 }
 
 func (l *filesLens) Enter(e lens.Entry) error {
@@ -146,48 +474,59 @@ func (l *filesLens) Enter(e lens.Entry) error {
 	return cmd.Start()
 }
 
-func (l *filesLens) ContextActions(e lens.Entry) []lens.Action {
-	return []lens.Action{
-		{
-			Name: "Reindex Files",
-			Run: func(entry lens.Entry) error {
-				go l.index()
-				return nil
-			},
-		},
+// shortenPath abbreviates each directory in full to two characters, and
+// replaces home with ~. It also returns where each rune of full ended up in
+// the shortened path, or -1 for runes that were dropped.
+func shortenPath(home, full string) (string, []int) {
+	runes := []rune(full)
+
+	where := make([]int, len(runes))
+	for i := range where {
+		where[i] = -1
+	}
+
+	// The path as displayed, before abbreviating, with the index in full
+	// that each rune came from
+	shown := runes
+	from := make([]int, len(runes))
+	for i := range from {
+		from[i] = i
 	}
-}
 
-func shortenPath(home, full string) string {
 	if strings.HasPrefix(full, home) {
-		full = "~" + strings.TrimPrefix(full, home)
+		n := len([]rune(home))
+		shown = append([]rune{'~'}, runes[n:]...)
+		from = append([]int{-1}, from[n:]...)
 	}
 
-	sep := string(os.PathSeparator)
-	hasLeadingSlash := strings.HasPrefix(full, sep)
+	sep := os.PathSeparator
 
-	parts := strings.Split(full, sep)
-	if len(parts) <= 2 {
-		return full
+	parts := 1
+	for _, r := range shown {
+		if r == sep {
+			parts++
+		}
 	}
 
-	for i := 0; i < len(parts)-1; i++ {
-		part := parts[i]
+	var short []rune
+	part, kept := 0, 0
 
-		if part == "" || part == "~" {
+	for i, r := range shown {
+		if r == sep {
+			part++
+			kept = 0
+		} else if parts > 2 && part < parts-1 && kept >= 2 {
+			// Everything but the last part is cut down to two characters
 			continue
+		} else {
+			kept++
 		}
 
-		if len(part) > 2 {
-			parts[i] = part[:2]
+		if from[i] >= 0 {
+			where[from[i]] = len(short)
 		}
+		short = append(short, r)
 	}
 
-	short := strings.Join(parts, sep)
-
-	if hasLeadingSlash && !strings.HasPrefix(short, sep) {
-		short = sep + short
-	}
-
-	return short
+	return string(short), where
 }
@@ -0,0 +1,167 @@
+package files
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Files listing paths to leave out of the index, read from every directory
+// walked
+var ignoreFiles = []string{".gitignore", ".ignore", ".fdignore"}
+
+// rule is a pattern written like a line of a .gitignore file
+type rule struct {
+	// Directory the pattern is relative to
+	base string
+	// The pattern split at each slash. "**" matches any number of
+	// directories.
+	parts []string
+	// Re-include what an earlier rule left out
+	negate bool
+	// Only match directories
+	dirOnly bool
+}
+
+// parseRule parses a .gitignore line relative to base. ok is false for blank
+// lines and comments.
+func parseRule(base, line string) (r rule, ok bool) {
+	line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " ")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+
+	r.base = base
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// An escaped # or !
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule{}, false
+	}
+
+	// A pattern without a slash, other than at its end, matches at any
+	// depth. Otherwise it's relative to base.
+	if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+	r.parts = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	return r, true
+}
+
+// validPattern reports whether a glob from the config file can be parsed
+func validPattern(pattern string) bool {
+	_, err := path.Match(strings.TrimPrefix(pattern, "!"), "")
+	return err == nil
+}
+
+// match reports whether path, which is inside r.base, matches r
+func (r rule) match(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	rel, ok := strings.CutPrefix(path, r.base)
+	if !ok || rel == "" {
+		return false
+	}
+
+	// Unless base is the root directory, rel starts with a separator
+	sep := string(filepath.Separator)
+	if !strings.HasSuffix(r.base, sep) {
+		if rel, ok = strings.CutPrefix(rel, sep); !ok {
+			return false
+		}
+	}
+	return matchParts(r.parts, strings.Split(filepath.ToSlash(rel), "/"))
+}
+
+// matchParts matches the segments of a path against those of a pattern
+func matchParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				// A trailing ** matches everything inside, but not the
+				// directory itself
+				return len(name) > 0
+			}
+			for i := range len(name) + 1 {
+				if matchParts(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matches reports whether the last of rules to match path is not negated. As
+// in .gitignore files, later rules override earlier ones.
+func matches(rules []rule, path string, isDir bool) bool {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].match(path, isDir) {
+			return !rules[i].negate
+		}
+	}
+	return false
+}
+
+// parseRules parses patterns relative to base
+func parseRules(base string, patterns []string) []rule {
+	var rules []rule
+	for _, p := range patterns {
+		if r, ok := parseRule(base, p); ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// readIgnoreFiles returns rules with those of the ignore files in dir added,
+// and when the newest of them was last modified. rules itself is left alone,
+// since it's shared with dir's siblings.
+func readIgnoreFiles(dir string, rules []rule) ([]rule, int64) {
+	rules = slices.Clip(rules)
+
+	var modTime int64
+	for _, name := range ignoreFiles {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+
+		if info, err := f.Stat(); err == nil {
+			modTime = max(modTime, info.ModTime().UnixNano())
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if r, ok := parseRule(dir, scanner.Text()); ok {
+				rules = append(rules, r)
+			}
+		}
+		f.Close()
+	}
+	return rules, modTime
+}
@@ -0,0 +1,420 @@
+package files
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// application is an application from a .desktop file
+type application struct {
+	// The desktop file ID, like org.gnome.Nautilus.desktop
+	id        string
+	path      string
+	name      string
+	exec      string
+	terminal  bool
+	mimeTypes []string
+}
+
+// applications are the installed applications, read again when an
+// applications directory changes
+var applications struct {
+	mu sync.Mutex
+	// When each applications and config directory was last modified, as of
+	// reading
+	stamp string
+	// By desktop file ID, and in order of importance
+	byID  map[string]application
+	order []string
+	// The types each type is a subclass of
+	parents map[string][]string
+	// From mimeapps.list files, desktop file IDs by type
+	defaults, added, removed map[string][]string
+}
+
+// dataDirs returns $XDG_DATA_HOME and $XDG_DATA_DIRS, most important first
+func dataDirs() []string {
+	home := os.Getenv("XDG_DATA_HOME")
+	if home == "" {
+		h, _ := os.UserHomeDir()
+		home = filepath.Join(h, ".local", "share")
+	}
+
+	dirs := os.Getenv("XDG_DATA_DIRS")
+	if dirs == "" {
+		dirs = "/usr/local/share:/usr/share"
+	}
+	return append([]string{home}, filepath.SplitList(dirs)...)
+}
+
+// configDirs returns $XDG_CONFIG_HOME and $XDG_CONFIG_DIRS, most important
+// first
+func configDirs() []string {
+	home := os.Getenv("XDG_CONFIG_HOME")
+	if home == "" {
+		h, _ := os.UserHomeDir()
+		home = filepath.Join(h, ".config")
+	}
+
+	dirs := os.Getenv("XDG_CONFIG_DIRS")
+	if dirs == "" {
+		dirs = "/etc/xdg"
+	}
+	return append([]string{home}, filepath.SplitList(dirs)...)
+}
+
+// loadApplications reads the applications, unless none has changed since
+// they were last read. applications.mu must be held.
+func loadApplications() {
+	var appDirs []string
+	for _, dir := range dataDirs() {
+		appDirs = append(appDirs, filepath.Join(dir, "applications"))
+	}
+
+	var stamp strings.Builder
+	for _, dir := range slices.Concat(appDirs, configDirs()) {
+		if info, err := os.Stat(dir); err == nil {
+			stamp.WriteString(info.ModTime().String())
+		}
+		stamp.WriteByte(0)
+	}
+	if applications.byID != nil && stamp.String() == applications.stamp {
+		return
+	}
+
+	applications.stamp = stamp.String()
+	applications.byID = make(map[string]application)
+	applications.order = nil
+	applications.parents = make(map[string][]string)
+	applications.defaults = make(map[string][]string)
+	applications.added = make(map[string][]string)
+	applications.removed = make(map[string][]string)
+
+	for _, dir := range appDirs {
+		_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".desktop") {
+				return nil
+			}
+
+			// Files in subdirectories are named with dashes in place of
+			// slashes
+			rel, _ := filepath.Rel(dir, path)
+			id := strings.ReplaceAll(filepath.ToSlash(rel), "/", "-")
+
+			// Earlier directories take precedence
+			if _, ok := applications.byID[id]; ok {
+				return nil
+			}
+			if app, ok := readDesktopFile(path); ok {
+				app.id = id
+				applications.byID[id] = app
+				applications.order = append(applications.order, id)
+			} else {
+				// Not an application, or hidden, which hides files with the
+				// same ID in later directories too
+				applications.byID[id] = application{}
+			}
+			return nil
+		})
+	}
+
+	// The most important file that mentions a type wins for defaults, the
+	// others add to the associations
+	for _, dir := range slices.Concat(configDirs(), appDirs) {
+		readMimeApps(filepath.Join(dir, "mimeapps.list"))
+	}
+
+	for _, dir := range dataDirs() {
+		readSubclasses(filepath.Join(dir, "mime", "subclasses"))
+	}
+}
+
+// readDesktopFile reads an application's .desktop file. ok is false for
+// files that aren't applications, or are hidden.
+func readDesktopFile(path string) (app application, ok bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return application{}, false
+	}
+	defer f.Close()
+
+	app.path = path
+	isApp, inEntry := false, false
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inEntry = line == "[Desktop Entry]"
+			continue
+		}
+		if !inEntry {
+			continue
+		}
+
+		k, v, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+
+		switch strings.TrimSpace(k) {
+		case "Type":
+			isApp = strings.TrimSpace(v) == "Application"
+		case "Name":
+			app.name = unescapeDesktop(strings.TrimSpace(v))
+		case "Exec":
+			app.exec = unescapeDesktop(strings.TrimSpace(v))
+		case "Terminal":
+			app.terminal = strings.TrimSpace(v) == "true"
+		case "MimeType":
+			app.mimeTypes = splitList(v)
+		case "Hidden":
+			if strings.TrimSpace(v) == "true" {
+				return application{}, false
+			}
+		}
+	}
+	return app, isApp && app.exec != ""
+}
+
+// readMimeApps reads the default and added applications for each type from
+// a mimeapps.list file, and those removed
+func readMimeApps(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var group map[string][]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch line {
+		case "[Default Applications]":
+			group = applications.defaults
+			continue
+		case "[Added Associations]":
+			group = applications.added
+			continue
+		case "[Removed Associations]":
+			group = applications.removed
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			group = nil
+			continue
+		}
+
+		mimeType, ids, found := strings.Cut(line, "=")
+		if !found || group == nil {
+			continue
+		}
+		mimeType = strings.TrimSpace(mimeType)
+		group[mimeType] = append(group[mimeType], splitList(ids)...)
+	}
+}
+
+// readSubclasses reads which types are subclasses of which, from a
+// shared-mime-info subclasses file
+func readSubclasses(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	for line := range strings.Lines(string(data)) {
+		if child, parent, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+			applications.parents[child] = append(applications.parents[child], parent)
+		}
+	}
+}
+
+// applicationsFor returns the applications that open files of mimeType, the
+// default first
+func applicationsFor(mimeType string) []application {
+	applications.mu.Lock()
+	defer applications.mu.Unlock()
+
+	loadApplications()
+
+	var apps []application
+	add := func(t, id string) {
+		app, ok := applications.byID[id]
+		if !ok || app.id == "" || slices.Contains(applications.removed[t], id) {
+			return
+		}
+		if slices.ContainsFunc(apps, func(a application) bool { return a.id == id }) {
+			return
+		}
+		apps = append(apps, app)
+	}
+
+	// Applications for a type can also open its subclasses
+	for _, t := range supertypes(mimeType) {
+		for _, id := range applications.defaults[t] {
+			add(t, id)
+		}
+		for _, id := range applications.added[t] {
+			add(t, id)
+		}
+		for _, id := range applications.order {
+			if slices.Contains(applications.byID[id].mimeTypes, t) {
+				add(t, id)
+			}
+		}
+	}
+	return apps
+}
+
+// supertypes returns mimeType followed by the types it's a subclass of,
+// nearest first. applications.mu must be held.
+func supertypes(mimeType string) []string {
+	types := []string{mimeType}
+	for i := 0; i < len(types); i++ {
+		for _, parent := range applications.parents[types[i]] {
+			if !slices.Contains(types, parent) {
+				types = append(types, parent)
+			}
+		}
+	}
+
+	// Every text type is plain text
+	if strings.HasPrefix(mimeType, "text/") && !slices.Contains(types, "text/plain") {
+		types = append(types, "text/plain")
+	}
+	return types
+}
+
+// mimeTypeOf returns the type of the file at path, going by its name, or
+// failing that its contents
+func mimeTypeOf(path string, info os.FileInfo) string {
+	if info.IsDir() {
+		return "inode/directory"
+	}
+
+	t := mime.TypeByExtension(filepath.Ext(path))
+	if t == "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return "application/octet-stream"
+		}
+		defer f.Close()
+
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(f, head)
+		t = http.DetectContentType(head[:n])
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(t); err == nil {
+		return mediaType
+	}
+	return t
+}
+
+// command returns the command line that opens path with app
+func (app application) command(path string) []string {
+	var args []string
+	given := false
+
+	for _, arg := range splitExec(app.exec) {
+		switch arg {
+		case "%f", "%F":
+			args = append(args, path)
+			given = true
+			continue
+		case "%u", "%U":
+			args = append(args, fileURI(path))
+			given = true
+			continue
+		case "%i":
+			// Would be the icon, which isn't known
+			continue
+		}
+
+		// Other field codes can be part of an argument
+		var b strings.Builder
+		for i := 0; i < len(arg); i++ {
+			if arg[i] != '%' || i+1 == len(arg) {
+				b.WriteByte(arg[i])
+				continue
+			}
+			i++
+			switch arg[i] {
+			case '%':
+				b.WriteByte('%')
+			case 'c':
+				b.WriteString(app.name)
+			case 'k':
+				b.WriteString(app.path)
+			}
+		}
+		args = append(args, b.String())
+	}
+
+	// Applications that don't say where the file goes mostly take it last
+	if !given {
+		args = append(args, path)
+	}
+	return args
+}
+
+// splitExec splits an Exec value into arguments. Arguments can be quoted,
+// and inside quotes, backslashes escape ", `, $ and \.
+func splitExec(s string) []string {
+	var (
+		args     []string
+		arg      strings.Builder
+		inArg    bool
+		inQuotes bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuotes && c == '\\' && i+1 < len(s):
+			i++
+			arg.WriteByte(s[i])
+		case c == '"':
+			inQuotes = !inQuotes
+			inArg = true
+		case !inQuotes && (c == ' ' || c == '\t'):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args
+}
+
+// unescapeDesktop decodes the escapes in a .desktop file's string values
+func unescapeDesktop(s string) string {
+	return strings.NewReplacer(`\s`, " ", `\n`, "\n", `\t`, "\t", `\r`, "\r", `\\`, `\`).Replace(s)
+}
+
+// splitList splits a list of values ended by semicolons
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(strings.TrimSpace(s), ";") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,38 @@
+//go:build darwin
+
+package files
+
+import (
+	"syscall"
+)
+
+// mounts returns the type of each mounted filesystem, like "apfs" or
+// "smbfs", by where it's mounted
+func mounts() map[string]string {
+	n, err := syscall.Getfsstat(nil, 0)
+	if err != nil {
+		return nil
+	}
+	buf := make([]syscall.Statfs_t, n)
+	if n, err = syscall.Getfsstat(buf, 0); err != nil {
+		return nil
+	}
+
+	m := make(map[string]string, n)
+	for _, st := range buf[:n] {
+		m[cString(st.Mntonname[:])] = cString(st.Fstypename[:])
+	}
+	return m
+}
+
+// cString converts a NUL-terminated C string
+func cString(s []int8) string {
+	b := make([]byte, 0, len(s))
+	for _, c := range s {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return string(b)
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+package files
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mounts returns the type of each mounted filesystem, like "ext4" or
+// "fuse.sshfs", by where it's mounted
+func mounts() map[string]string {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil
+	}
+
+	m := make(map[string]string)
+	for line := range strings.Lines(string(data)) {
+		// The mount point is the fifth field, and the type the first after
+		// the separator. The number of fields in between varies.
+		before, after, ok := strings.Cut(line, " - ")
+		if !ok {
+			continue
+		}
+		fields, rest := strings.Fields(before), strings.Fields(after)
+		if len(fields) < 5 || len(rest) == 0 {
+			continue
+		}
+		m[unescapeMount(fields[4])] = rest[0]
+	}
+	return m
+}
+
+// unescapeMount decodes the octal escapes written in place of spaces,
+// backslashes and the like in mount points
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
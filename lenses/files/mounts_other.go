@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package files
+
+// mounts isn't supported here, so no filesystems are skipped
+func mounts() map[string]string {
+	return nil
+}
@@ -0,0 +1,118 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/indium114/spyglass/lens"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+const defaultHighlight = "catppuccin-mocha"
+
+// Only the start of a file is read for its preview
+const (
+	previewBytes = 64 << 10
+	previewLines = 200
+)
+
+func (l *filesLens) Preview(ctx context.Context, e lens.Entry) (string, error) {
+	info, err := os.Stat(e.ID)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return previewDir(e.ID)
+	}
+
+	f, err := os.Open(e.ID)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, previewBytes))
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return fmt.Sprintf("Binary file, %d bytes", info.Size()), nil
+	}
+
+	// Highlighting the whole of a long file is wasted on a small pane
+	if i := nthIndex(data, '\n', previewLines); i >= 0 {
+		data = data[:i]
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return highlight(e.ID, string(data), l.highlight), nil
+}
+
+// previewDir lists a directory's contents, directories first
+func previewDir(path string) (string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+
+	var dirs, files []string
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, e.Name()+string(os.PathSeparator))
+		} else {
+			files = append(files, e.Name())
+		}
+	}
+
+	if len(entries) == 0 {
+		return "Empty directory", nil
+	}
+	return strings.Join(append(dirs, files...), "\n"), nil
+}
+
+// highlight colours source for the terminal, picking the language by the
+// file's name or, failing that, its contents
+func highlight(path, source, style string) string {
+	lexer := lexers.Match(filepath.Base(path))
+	if lexer == nil {
+		lexer = lexers.Analyse(source)
+	}
+	if lexer == nil {
+		return source
+	}
+
+	it, err := chroma.Coalesce(lexer).Tokenise(nil, source)
+	if err != nil {
+		return source
+	}
+
+	var b strings.Builder
+	if err := formatters.TTY256.Format(&b, styles.Get(style), it); err != nil {
+		return source
+	}
+	return b.String()
+}
+
+// nthIndex returns the index of the nth occurrence of c in data, or -1
+func nthIndex(data []byte, c byte, n int) int {
+	for i, b := range data {
+		if b == c {
+			n--
+			if n == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
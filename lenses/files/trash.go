@@ -0,0 +1,134 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// trash moves path to the trash, as the freedesktop.org Trash specification
+// describes, so that file managers can show and restore it
+func trash(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	dir, original, err := trashDir(path, info)
+	if err != nil {
+		return err
+	}
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return err
+		}
+	}
+
+	// The info file is created first, and claims the name
+	name := filepath.Base(path)
+	for i := 1; ; i++ {
+		trashed := name
+		if i > 1 {
+			trashed = name + "." + strconv.Itoa(i)
+		}
+
+		infoPath := filepath.Join(dir, "info", trashed+".trashinfo")
+		f, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			(&url.URL{Path: original}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(path, filepath.Join(dir, "files", trashed))
+		}
+		if err != nil {
+			_ = os.Remove(infoPath)
+		}
+		return err
+	}
+}
+
+// trashDir returns the trash directory for path, on the same filesystem so
+// that it can be moved there, and the path to record for restoring it
+func trashDir(path string, info os.FileInfo) (dir, original string, err error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+
+	dev := device(info)
+	if dev == device(existing(dataHome)) {
+		return filepath.Join(dataHome, "Trash"), path, nil
+	}
+
+	// Elsewhere, each mounted filesystem has its own trash at the top
+	top := filepath.Dir(path)
+	for top != "/" {
+		parent := filepath.Dir(top)
+		if parentInfo, err := os.Stat(parent); err != nil || device(parentInfo) != dev {
+			break
+		}
+		top = parent
+	}
+
+	original, err = filepath.Rel(top, path)
+	if err != nil {
+		return "", "", err
+	}
+	uid := strconv.Itoa(os.Getuid())
+
+	// A .Trash directory made by the administrator, which has to be sticky
+	// and not a symlink, holds a directory for each user
+	if shared, err := os.Lstat(filepath.Join(top, ".Trash")); err == nil &&
+		shared.IsDir() && shared.Mode()&fs.ModeSticky != 0 {
+		dir = filepath.Join(top, ".Trash", uid)
+		if err := os.MkdirAll(dir, 0700); err == nil {
+			return dir, original, nil
+		}
+	}
+	return filepath.Join(top, ".Trash-"+uid), original, nil
+}
+
+// existing returns the info of path, or of the nearest directory above it
+// that exists
+func existing(path string) os.FileInfo {
+	for {
+		if info, err := os.Stat(path); err == nil {
+			return info
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return nil
+		}
+		path = parent
+	}
+}
+
+// device returns the device info is on
+func device(info os.FileInfo) uint64 {
+	if info == nil {
+		return 0
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev)
+	}
+	return 0
+}
@@ -0,0 +1,363 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// record is a path found by walking the roots
+type record struct {
+	Path string
+	Dir  bool
+	// Walked to find what include patterns match inside, but not shown
+	Excluded bool
+	// For directories, whether what's inside was walked, rather than left
+	// out by max_depth or found through another path
+	Walked bool
+	// For walked directories, when they were last modified, in nanoseconds,
+	// which changes when anything is added to them or removed, and when the
+	// newest ignore file applying inside them was modified. Nothing else is
+	// kept about paths, since it would go out of date without them being
+	// read again.
+	ModTime   int64
+	RulesTime int64
+}
+
+// newRecord returns the record of a path that isn't walked
+func newRecord(path string, dir bool) record {
+	return record{Path: path, Dir: dir}
+}
+
+// walkedDir is a directory that was walked, along with what's needed to
+// index a path found in it later
+type walkedDir struct {
+	path      string
+	depth     int
+	rulesTime int64
+	rules     []rule
+	include   []rule
+}
+
+// walker walks the roots on several goroutines at once, reusing what an
+// earlier walk found in directories that haven't changed since
+type walker struct {
+	l   *filesLens
+	ctx context.Context
+
+	// What the earlier walk found in each directory, and the directories
+	// themselves
+	children map[string][]record
+	previous map[string]record
+
+	// Mount points of filesystems that aren't walked
+	skip map[string]bool
+
+	// Holds a slot for each goroutine walking besides the one that started
+	// the walk
+	workers chan struct{}
+	wg      sync.WaitGroup
+
+	// Number of paths found so far, for showing progress
+	found atomic.Int64
+
+	// Guards what follows, and calls to add
+	mu  sync.Mutex
+	add func([]record)
+	// Every directory walked, for watching
+	dirs []walkedDir
+	// Directories walked, so that none is walked twice by following a
+	// symlink or a bind mount
+	visited map[fileID]bool
+}
+
+// fileID identifies a file, wherever it's reached from
+type fileID struct {
+	dev, ino uint64
+}
+
+// newWalker returns a walker calling add with what's found in each
+// directory, until ctx is done. Directories are read again unless previous,
+// from an earlier walk with the same settings, still has them right.
+func newWalker(ctx context.Context, l *filesLens, previous []record, add func([]record)) *walker {
+	workers := l.workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	w := &walker{
+		l:        l,
+		ctx:      ctx,
+		children: make(map[string][]record),
+		previous: make(map[string]record),
+		skip:     make(map[string]bool),
+		workers:  make(chan struct{}, workers-1),
+		add:      add,
+		visited:  make(map[fileID]bool),
+	}
+
+	for _, r := range previous {
+		parent := filepath.Dir(r.Path)
+		w.children[parent] = append(w.children[parent], r)
+		if r.Dir {
+			w.previous[r.Path] = r
+		}
+	}
+
+	for dir, fsType := range mounts() {
+		if skipFilesystem(l.skipFilesystems, fsType) {
+			w.skip[dir] = true
+		}
+	}
+	return w
+}
+
+// settingsKey identifies the settings that decide what's indexed. Records
+// indexed with other settings can't be reused. "dotfiles" tells apart indexes
+// made since dotfiles were kept regardless of hidden.
+func (l *filesLens) settingsKey() string {
+	return fmt.Sprintf("%q %q %q %d dotfiles %t %t %t %q", l.roots, l.include, l.exclude, l.maxDepth, l.hidden, l.ignoreFiles,
+		l.followSymlinks, l.skipFilesystems)
+}
+
+// walk walks the roots, and returns once it's done or ctx is
+func (w *walker) walk() {
+	for _, root := range w.l.roots {
+		info, err := os.Stat(root)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+
+		include := parseRules(root, w.l.include)
+		excluded := len(include) > 0 && !matches(include, root, true)
+		w.run(func() {
+			w.walkDir(root, info, 0, 0, parseRules(root, w.l.exclude), include, excluded)
+		})
+	}
+	w.wait()
+}
+
+// run calls walk on a goroutine of its own if a worker is free, and on this
+// one otherwise
+func (w *walker) run(walk func()) {
+	select {
+	case w.workers <- struct{}{}:
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			walk()
+			<-w.workers
+		}()
+	default:
+		walk()
+	}
+}
+
+// wait waits for the directories passed to run to be walked
+func (w *walker) wait() {
+	w.wg.Wait()
+}
+
+// walkDir walks the directory dir, depth levels below its root. rulesTime is
+// when the newest ignore file applying to dir was modified. Paths matching
+// rules are left out, and so is anything inside them. Unless include is
+// empty, only paths matching it are shown, though every directory is walked.
+func (w *walker) walkDir(dir string, info os.FileInfo, depth int, rulesTime int64, rules, include []rule, excluded bool) {
+	if w.ctx.Err() != nil {
+		return
+	}
+
+	// Already walked, at another path
+	if !w.visit(info) {
+		if !excluded {
+			w.emit([]record{newRecord(dir, true)}, nil)
+		}
+		return
+	}
+
+	if w.l.ignoreFiles {
+		var changed int64
+		rules, changed = readIgnoreFiles(dir, rules)
+		rulesTime = max(rulesTime, changed)
+	}
+
+	modTime := info.ModTime().UnixNano()
+	records := []record{{Path: dir, Dir: true, Excluded: excluded, Walked: true, ModTime: modTime, RulesTime: rulesTime}}
+	walked := &walkedDir{path: dir, depth: depth, rulesTime: rulesTime, rules: rules, include: include}
+	defer func() {
+		w.emit(records, walked)
+	}()
+
+	// Nothing has changed in dir since the earlier walk
+	if p, ok := w.previous[dir]; ok && p.Walked && p.ModTime == modTime && p.RulesTime == rulesTime {
+		for _, r := range w.children[dir] {
+			if r.Dir && w.l.walkable(depth+1) {
+				w.run(func() {
+					w.walkChild(r.Path, depth+1, rulesTime, rules, include, r.Excluded)
+				})
+			} else {
+				records = append(records, r)
+			}
+		}
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		// Read it again next time, in case it can be then
+		records[0].Walked = false
+		return
+	}
+
+	for _, d := range entries {
+		path := filepath.Join(dir, d.Name())
+
+		// The type comes with the name, so most paths needn't be looked up
+		isDir := d.IsDir()
+		if d.Type()&fs.ModeSymlink != 0 && w.l.followSymlinks {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			isDir = info.IsDir()
+		}
+
+		keep, excluded := w.l.keep(path, isDir, rules, include)
+		if !keep {
+			continue
+		}
+
+		if isDir && w.l.walkable(depth+1) {
+			w.run(func() {
+				w.walkChild(path, depth+1, rulesTime, rules, include, excluded)
+			})
+		} else if !excluded {
+			records = append(records, newRecord(path, isDir))
+		}
+	}
+}
+
+// walkChild walks a directory found inside another, unless it's on a
+// filesystem that isn't walked
+func (w *walker) walkChild(path string, depth int, rulesTime int64, rules, include []rule, excluded bool) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return
+	}
+
+	// A symlink may lead anywhere inside a skipped filesystem, rather than
+	// to where it's mounted
+	target, inside := path, false
+	if info.Mode()&fs.ModeSymlink != 0 && w.l.followSymlinks {
+		if info, err = os.Stat(path); err != nil {
+			return
+		}
+		if target, err = filepath.EvalSymlinks(path); err != nil {
+			return
+		}
+		inside = true
+	}
+	if !info.IsDir() {
+		return
+	}
+
+	if w.skipped(target, inside) {
+		if !excluded {
+			w.emit([]record{newRecord(path, true)}, nil)
+		}
+		return
+	}
+	w.walkDir(path, info, depth, rulesTime, rules, include, excluded)
+}
+
+// emit passes on the records found in a directory, and notes the directory
+// for watching unless dir is nil
+func (w *walker) emit(records []record, dir *walkedDir) {
+	found := 0
+	for _, r := range records {
+		if !r.Excluded {
+			found++
+		}
+	}
+	w.found.Add(int64(found))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if dir != nil {
+		w.dirs = append(w.dirs, *dir)
+	}
+	w.add(records)
+}
+
+// visit notes that the directory described by info is being walked, and
+// reports whether it wasn't already
+func (w *walker) visit(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return true
+	}
+	id := fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.visited[id] {
+		return false
+	}
+	w.visited[id] = true
+	return true
+}
+
+// skipped reports whether dir is where a filesystem that isn't walked is
+// mounted. With inside, dir may also be anywhere inside one.
+func (w *walker) skipped(dir string, inside bool) bool {
+	for len(w.skip) > 0 {
+		if w.skip[dir] {
+			return true
+		}
+
+		parent := filepath.Dir(dir)
+		if !inside || parent == dir {
+			return false
+		}
+		dir = parent
+	}
+	return false
+}
+
+// skipFilesystem reports whether filesystems of type fsType aren't walked.
+// A name like "fuse" covers subtypes like "fuse.sshfs" too.
+func skipFilesystem(names []string, fsType string) bool {
+	return slices.ContainsFunc(names, func(name string) bool {
+		return fsType == name || strings.HasPrefix(fsType, name+".")
+	})
+}
+
+// walkable reports whether directories depth levels below a root are walked
+func (l *filesLens) walkable(depth int) bool {
+	return l.maxDepth <= 0 || depth < l.maxDepth
+}
+
+// keep reports whether path belongs in the index, given the rules of the
+// directory it's in, and whether it's excluded from being shown by include
+func (l *filesLens) keep(path string, isDir bool, rules, include []rule) (keep, excluded bool) {
+	// Dotfiles are kept, but hidden directories, full of caches and
+	// settings, are only walked if asked for
+	name := filepath.Base(path)
+	if name == ".git" || (isDir && !l.hidden && strings.HasPrefix(name, ".")) {
+		return false, false
+	}
+	if matches(rules, path, isDir) {
+		return false, false
+	}
+	return true, len(include) > 0 && !matches(include, path, isDir)
+}
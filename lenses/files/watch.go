@@ -0,0 +1,192 @@
+package files
+
+import (
+	"cmp"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Directories watched for changes, unless configured. The shallowest are
+// watched first.
+const defaultMaxWatches = 8192
+
+// watcher reports changes to walked directories as they happen
+type watcher interface {
+	// add starts watching dirs, until the limit is reached
+	add(dirs []walkedDir)
+	// remove stops watching dir, and the directories inside it
+	remove(dir string)
+	close()
+}
+
+// change is a name added to, or removed from, a watched directory
+type change struct {
+	dir  walkedDir
+	name string
+}
+
+// batch is changes seen together, and whether some were lost
+type batch struct {
+	changes []change
+	lost    bool
+}
+
+// errWatchUnsupported is returned by newWatcher on platforms it doesn't
+// support. The index is then only updated by walking the roots again.
+var errWatchUnsupported = errors.New("watching for changes isn't supported")
+
+// watch starts keeping the index up to date as dirs change, in place of any
+// earlier watcher
+func (l *filesLens) watch(dirs []walkedDir) {
+	l.mu.Lock()
+	old := l.watcher
+	l.watcher = nil
+	l.mu.Unlock()
+
+	if old != nil {
+		old.close()
+	}
+	if l.maxWatches <= 0 {
+		return
+	}
+
+	w, err := newWatcher(l.maxWatches, l.applyChanges)
+	if err != nil {
+		if !errors.Is(err, errWatchUnsupported) {
+			log.Println("files: not watching for changes:", err)
+		}
+		return
+	}
+
+	slices.SortStableFunc(dirs, func(a, b walkedDir) int {
+		return cmp.Compare(a.depth, b.depth)
+	})
+	w.add(dirs)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Closed while the directories were being added
+	if l.ctx.Err() != nil {
+		w.close()
+		return
+	}
+	l.watcher = w
+}
+
+// applyChanges updates the index with changes seen by the watcher. If lost,
+// some changes were missed, and the roots are walked again instead.
+func (l *filesLens) applyChanges(changes []change, lost bool) {
+	// Ignore files change what's indexed everywhere below them
+	lost = lost || (l.ignoreFiles && slices.ContainsFunc(changes, func(c change) bool {
+		return slices.Contains(ignoreFiles, c.name)
+	}))
+
+	l.mu.Lock()
+	if l.indexing {
+		l.queueChanges(changes, lost)
+		l.mu.Unlock()
+		return
+	}
+	w := l.watcher
+	l.mu.Unlock()
+
+	if lost {
+		l.reindex(false)
+		return
+	}
+
+	// Each changed path is removed, along with anything inside it, and then
+	// added again if it's still there
+	changed := make(map[string]change)
+	for _, c := range changes {
+		changed[filepath.Join(c.dir.path, c.name)] = c
+	}
+
+	var added []record
+	walker := newWalker(l.ctx, l, nil, func(records []record) {
+		added = append(added, records...)
+	})
+	var found []record
+	for path, c := range changed {
+		if w != nil {
+			w.remove(path)
+		}
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		if info.Mode()&fs.ModeSymlink != 0 && l.followSymlinks {
+			if info, err = os.Stat(path); err != nil {
+				continue
+			}
+		}
+
+		keep, excluded := l.keep(path, info.IsDir(), c.dir.rules, c.dir.include)
+		if !keep {
+			continue
+		}
+
+		if info.IsDir() && l.walkable(c.dir.depth+1) {
+			walker.run(func() {
+				walker.walkChild(path, c.dir.depth+1, c.dir.rulesTime, c.dir.rules, c.dir.include, excluded)
+			})
+		} else if !excluded {
+			found = append(found, newRecord(path, info.IsDir()))
+		}
+	}
+	walker.wait()
+	added = append(added, found...)
+
+	// The index may have changed while the changes were read, so they're
+	// applied to it as it is now
+	l.mu.Lock()
+	if l.indexing {
+		l.queueChanges(changes, false)
+		l.mu.Unlock()
+		return
+	}
+	updated := make([]record, 0, len(l.files)+len(added))
+	for _, r := range l.files {
+		if !within(changed, r.Path) {
+			updated = append(updated, r)
+		}
+	}
+	updated = append(updated, added...)
+	l.publish(updated, true)
+	key := l.indexedWith
+	l.mu.Unlock()
+
+	if w != nil {
+		w.add(walker.dirs)
+	}
+	l.save(key, updated)
+}
+
+// queueChanges keeps changes seen during a walk, to be applied once it's
+// done, since it may already have been through the directories they're in.
+// l.mu must be held.
+func (l *filesLens) queueChanges(changes []change, lost bool) {
+	l.queued.changes = append(l.queued.changes, changes...)
+	l.queued.lost = l.queued.lost || lost
+}
+
+// within reports whether path, or a directory it's inside, is in paths
+func within(paths map[string]change, path string) bool {
+	for {
+		if _, ok := paths[path]; ok {
+			return true
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,186 @@
+//go:build linux
+
+package files
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Events that change what a directory holds. Records hold nothing about a
+// file that editing it or changing its attributes would change, so those
+// events aren't watched: each would mean copying the whole index for nothing.
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW
+
+// The index is updated once no events have arrived for settleTime, so that a
+// burst of them, like unpacking an archive, updates it once. A burst that
+// goes on and on still updates it every maxSettleTime.
+const (
+	settleTime    = 250 * time.Millisecond
+	maxSettleTime = 5 * time.Second
+)
+
+// inotifyWatcher watches directories with inotify
+type inotifyWatcher struct {
+	file    *os.File
+	fd      int
+	limit   int
+	changed func([]change, bool)
+
+	// Watched directories, by watch descriptor
+	mu   sync.Mutex
+	dirs map[int]walkedDir
+	// Whether the limit has been reached, and logged
+	full bool
+}
+
+func newWatcher(limit int, changed func([]change, bool)) (watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &inotifyWatcher{
+		// A non-blocking file can be closed while it's being read
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		fd:      fd,
+		limit:   limit,
+		changed: changed,
+		dirs:    make(map[int]walkedDir),
+	}
+	go w.read()
+	return w, nil
+}
+
+func (w *inotifyWatcher) add(dirs []walkedDir) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, d := range dirs {
+		if len(w.dirs) >= w.limit {
+			w.reachedLimit()
+			return
+		}
+
+		wd, err := syscall.InotifyAddWatch(w.fd, d.path, watchMask)
+		if errors.Is(err, syscall.ENOSPC) {
+			// The system-wide limit, fs.inotify.max_user_watches
+			w.reachedLimit()
+			return
+		}
+		if err != nil {
+			continue
+		}
+		w.dirs[wd] = d
+	}
+}
+
+// reachedLimit logs that no more directories can be watched, the first time
+// it happens. w.mu must be held.
+func (w *inotifyWatcher) reachedLimit() {
+	if !w.full {
+		w.full = true
+		log.Printf("files: watching %d directories for changes, the rest are only updated when reindexed", len(w.dirs))
+	}
+}
+
+func (w *inotifyWatcher) remove(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	prefix := dir + string(filepath.Separator)
+	for wd, d := range w.dirs {
+		if d.path == dir || strings.HasPrefix(d.path, prefix) {
+			_, _ = syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+func (w *inotifyWatcher) close() {
+	_ = w.file.Close()
+}
+
+// read reads events until the watcher is closed
+func (w *inotifyWatcher) read() {
+	batches := make(chan batch)
+	defer close(batches)
+	go w.settle(batches)
+
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		var b batch
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			// struct inotify_event, followed by a NUL-padded name
+			wd := int(int32(binary.NativeEndian.Uint32(buf[off:])))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			name := strings.TrimRight(string(buf[off+syscall.SizeofInotifyEvent:off+syscall.SizeofInotifyEvent+nameLen]), "\x00")
+			off += syscall.SizeofInotifyEvent + nameLen
+
+			if mask&syscall.IN_Q_OVERFLOW != 0 {
+				b.lost = true
+				continue
+			}
+
+			w.mu.Lock()
+			d, ok := w.dirs[wd]
+			if mask&syscall.IN_IGNORED != 0 {
+				// The directory was removed, taking its watch with it
+				delete(w.dirs, wd)
+			}
+			w.mu.Unlock()
+
+			if ok && name != "" {
+				b.changes = append(b.changes, change{dir: d, name: name})
+			}
+		}
+		batches <- b
+	}
+}
+
+// settle gathers batches of changes until none have arrived for a while,
+// then applies them together
+func (w *inotifyWatcher) settle(batches <-chan batch) {
+	var (
+		pending batch
+		// When the first pending change arrived
+		since time.Time
+		timer = time.NewTimer(0)
+		armed bool
+	)
+	timer.Stop()
+
+	for {
+		select {
+		case b, ok := <-batches:
+			if !ok {
+				timer.Stop()
+				return
+			}
+			pending.changes = append(pending.changes, b.changes...)
+			pending.lost = pending.lost || b.lost
+			if !armed {
+				since, armed = time.Now(), true
+			}
+			timer.Reset(min(settleTime, maxSettleTime-time.Since(since)))
+
+		case <-timer.C:
+			w.changed(pending.changes, pending.lost)
+			pending, armed = batch{}, false
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package files
+
+func newWatcher(limit int, changed func([]change, bool)) (watcher, error) {
+	return nil, errWatchUnsupported
+}
@@ -1,7 +1,9 @@
 package nerdfont
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -9,13 +11,26 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/indium114/spyglass/lens"
+	"github.com/indium114/spyglass/match"
+
+	"github.com/charmbracelet/lipgloss"
 )
 
+// Score given to glyphs found by pasting the glyph itself
+const scoreGlyph = 1000
+
+// How long downloading the glyph file may take
+const downloadTimeout = 30 * time.Second
+
 const glyphURL = "https://raw.githubusercontent.com/ryanoasis/nerd-fonts/refs/heads/master/glyphnames.json"
 
 type nerdFontLens struct {
+	// Reads the glyph file the first time it's needed
+	start sync.Once
+
 	mu     sync.RWMutex
 	glyphs []glyphEntry
 }
@@ -27,33 +42,54 @@ type glyphEntry struct {
 }
 
 func New() lens.Lens {
-	l := &nerdFontLens{}
-	l.loadCache()
-	return l
+	return &nerdFontLens{}
 }
 
 func (n *nerdFontLens) Name() string {
 	return "NerdFont"
 }
 
+func (n *nerdFontLens) Keyword() string {
+	return ":"
+}
+
 func cachePath() string {
 	dir, _ := os.UserCacheDir()
 	return filepath.Join(dir, "spyglass", "nerd-fonts", "glyphnames.json")
 }
 
-// Load cached glyphs
+// Refresh loads the glyphs ahead of the first search
+func (n *nerdFontLens) Refresh() {
+	n.load()
+}
+
+func (n *nerdFontLens) load() {
+	n.start.Do(n.loadCache)
+}
+
+// Load cached glyphs, or download them if there are none
 func (n *nerdFontLens) loadCache() {
-	path := cachePath()
-	data, err := os.ReadFile(path)
-	if err != nil {
-		go n.downloadGlyphs()
-		return
+	data, err := os.ReadFile(cachePath())
+	if err == nil {
+		var glyphs []glyphEntry
+		if glyphs, err = parseGlyphs(data); err == nil {
+			n.mu.Lock()
+			n.glyphs = glyphs
+			n.mu.Unlock()
+			return
+		}
 	}
 
+	go func() {
+		_ = n.downloadGlyphs()
+	}()
+}
+
+// parseGlyphs reads the glyph file
+func parseGlyphs(data []byte) ([]glyphEntry, error) {
 	var raw map[string]map[string]string
 	if err := json.Unmarshal(data, &raw); err != nil {
-		go n.downloadGlyphs()
-		return
+		return nil, err
 	}
 
 	var glyphs []glyphEntry
@@ -67,54 +103,99 @@ func (n *nerdFontLens) loadCache() {
 			glyphs = append(glyphs, g)
 		}
 	}
-
-	n.mu.Lock()
-	n.glyphs = glyphs
-	n.mu.Unlock()
+	return glyphs, nil
 }
 
 // Download glyph JSON and update cache
-func (n *nerdFontLens) downloadGlyphs() {
-	resp, err := http.Get(glyphURL)
+func (n *nerdFontLens) downloadGlyphs() error {
+	client := http.Client{Timeout: downloadTimeout}
+	resp, err := client.Get(glyphURL)
 	if err != nil {
-		return
+		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading glyphs: %s", resp.Status)
+	}
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return
+		return err
+	}
+	glyphs, err := parseGlyphs(data)
+	if err != nil {
+		return fmt.Errorf("downloading glyphs: %w", err)
 	}
 
 	path := cachePath()
 	_ = os.MkdirAll(filepath.Dir(path), 0755)
 	_ = os.WriteFile(path, data, 0644)
 
-	// Reload
-	n.loadCache()
+	n.mu.Lock()
+	n.glyphs = glyphs
+	n.mu.Unlock()
+	return nil
 }
 
 func (n *nerdFontLens) Search(query string) ([]lens.Entry, error) {
+	n.load()
+
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 
-	q := strings.ToLower(strings.TrimSpace(query))
+	q := strings.TrimSpace(query)
 	var entries []lens.Entry
 	for _, g := range n.glyphs {
-		if q == "" || strings.Contains(strings.ToLower(g.Name), q) || strings.Contains(strings.ToLower(g.Char), q) {
+		score, matches, ok := match.Match(q, g.Name)
+		if !ok && q != "" && strings.Contains(g.Char, q) {
+			// Pasting a glyph finds its name
+			score, ok = scoreGlyph, true
+		}
+
+		if ok {
 			entries = append(entries, lens.Entry{
 				ID:          g.Name,
 				Title:       g.Name,
 				Icon:        g.Char,
 				Description: "Code: " + g.Code,
+				Score:       score,
+				Matches:     matches,
 			})
 		}
 	}
 	return entries, nil
 }
 
+func (n *nerdFontLens) Preview(ctx context.Context, e lens.Entry) (string, error) {
+	glyph := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		Padding(1, 4).
+		Render(e.Icon)
+
+	var codes []string
+	for _, r := range e.Icon {
+		codes = append(codes, fmt.Sprintf("U+%04X", r))
+	}
+
+	return fmt.Sprintf("%s\n\n%s\n\nCodepoint  %s\nUTF-8      % X",
+		glyph, e.Title, strings.Join(codes, " "), e.Icon), nil
+}
+
 func (n *nerdFontLens) Enter(e lens.Entry) error {
-	// Copy to clipboard
+	return copyText(e.Icon)
+}
+
+// EnterBatch copies the glyphs together, in the order given
+func (n *nerdFontLens) EnterBatch(entries []lens.Entry) error {
+	var glyphs strings.Builder
+	for _, e := range entries {
+		glyphs.WriteString(e.Icon)
+	}
+	return copyText(glyphs.String())
+}
+
+// copyText copies text to the clipboard
+func copyText(text string) error {
 	var cmd *exec.Cmd
 	if _, err := exec.LookPath("wl-copy"); err == nil {
 		cmd = exec.Command("wl-copy")
@@ -128,7 +209,7 @@ func (n *nerdFontLens) Enter(e lens.Entry) error {
 
 	in, _ := cmd.StdinPipe()
 	cmd.Start()
-	in.Write([]byte(e.Icon))
+	in.Write([]byte(text))
 	in.Close()
 	cmd.Wait()
 
@@ -138,10 +219,11 @@ func (n *nerdFontLens) Enter(e lens.Entry) error {
 func (n *nerdFontLens) ContextActions(e lens.Entry) []lens.Action {
 	return []lens.Action{
 		{
-			Name: "Redownload glyph file",
+			Name:  "Redownload glyph file",
+			After: lens.AfterRefresh,
+			// Searched again once the new glyphs are in
 			Run: func(entry lens.Entry) error {
-				go n.downloadGlyphs()
-				return nil
+				return n.downloadGlyphs()
 			},
 		},
 	}
@@ -5,6 +5,7 @@ import (
 	"syscall"
 
 	"github.com/indium114/spyglass/lens"
+	"github.com/indium114/spyglass/match"
 )
 
 type powerLens struct{}
@@ -18,26 +19,36 @@ func (p *powerLens) Name() string {
 }
 
 func (p *powerLens) Search(query string) ([]lens.Entry, error) {
-	return []lens.Entry{
-		{
-			ID:          "shutdown",
-			Title:       "Shutdown",
-			Icon:        "⏻",
-			Description: "Power off the system",
-		},
-		{
-			ID:          "reboot",
-			Title:       "Reboot",
-			Icon:        "",
-			Description: "Restart the system",
-		},
-		{
-			ID:          "suspend",
-			Title:       "Suspend",
-			Icon:        "⏾",
-			Description: "Suspend to RAM",
-		},
-	}, nil
+	var results []lens.Entry
+	for _, e := range entries {
+		if score, matches, ok := match.Match(query, e.Title); ok {
+			e.Score = score
+			e.Matches = matches
+			results = append(results, e)
+		}
+	}
+	return results, nil
+}
+
+var entries = []lens.Entry{
+	{
+		ID:          "shutdown",
+		Title:       "Shutdown",
+		Icon:        "⏻",
+		Description: "Power off the system",
+	},
+	{
+		ID:          "reboot",
+		Title:       "Reboot",
+		Icon:        "",
+		Description: "Restart the system",
+	},
+	{
+		ID:          "suspend",
+		Title:       "Suspend",
+		Icon:        "⏾",
+		Description: "Suspend to RAM",
+	},
 }
 
 func (p *powerLens) Enter(entry lens.Entry) error {
@@ -0,0 +1,381 @@
+// Package script loads lenses defined in YAML files, which list their
+// entries by running a command
+package script
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/indium114/spyglass/lens"
+	"github.com/indium114/spyglass/match"
+
+	"gopkg.in/yaml.v3"
+)
+
+type definition struct {
+	Name    string `yaml:"name"`
+	Icon    string `yaml:"icon"`
+	Keyword string `yaml:"keyword"`
+
+	// Command listing the entries
+	Command string `yaml:"command"`
+	// How the command's output is read: lines, tsv or json
+	Format string `yaml:"format"`
+	// Fields of each tsv column
+	Columns []string `yaml:"columns"`
+	// Run the command again for every query, rather than filtering its
+	// output here
+	PerQuery bool `yaml:"per_query"`
+
+	// Commands run on an entry
+	Enter   string `yaml:"enter"`
+	Actions []struct {
+		Name    string     `yaml:"name"`
+		Command string     `yaml:"command"`
+		After   lens.After `yaml:"after"`
+	} `yaml:"actions"`
+}
+
+// Columns of tsv output, unless configured
+var defaultColumns = []string{"id", "title", "description"}
+
+type scriptLens struct {
+	def definition
+
+	// Cancelled by Close, stopping the command
+	ctx  context.Context
+	stop context.CancelFunc
+
+	// Output of the command, kept between searches unless it runs per query
+	mu      sync.Mutex
+	listing *listing
+}
+
+// listing is one run of the command, shared by every search made while it
+// runs
+type listing struct {
+	// Closed once entries and err are set
+	done    chan struct{}
+	entries []lens.Entry
+	err     error
+}
+
+// Load reads every lens defined in dir. Files that can't be read are
+// reported, and left out.
+func Load(dir string) ([]lens.Lens, []error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var (
+		lenses []lens.Lens
+		errs   []error
+	)
+	for _, path := range files {
+		l, err := load(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		lenses = append(lenses, l)
+	}
+	return lenses, errs
+}
+
+func load(path string) (*scriptLens, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var def definition
+	if err := yaml.Unmarshal(data, &def); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case def.Name == "":
+		return nil, errors.New("lens has no name")
+	case def.Command == "":
+		return nil, errors.New("lens has no command")
+	}
+
+	switch def.Format {
+	case "":
+		def.Format = "lines"
+	case "lines", "json":
+	case "tsv":
+		if len(def.Columns) == 0 {
+			def.Columns = defaultColumns
+		}
+		for _, c := range def.Columns {
+			switch c {
+			case "id", "title", "icon", "description", "":
+			default:
+				return nil, fmt.Errorf("unknown column %q, expected id, title, icon or description", c)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected lines, tsv or json", def.Format)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	return &scriptLens{def: def, ctx: ctx, stop: stop}, nil
+}
+
+func (s *scriptLens) Name() string {
+	return s.def.Name
+}
+
+func (s *scriptLens) Keyword() string {
+	return s.def.Keyword
+}
+
+// Refresh forgets the command's output, so it runs again on the next search
+func (s *scriptLens) Refresh() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listing = nil
+}
+
+// Close stops the command if it's running
+func (s *scriptLens) Close() error {
+	s.stop()
+	return nil
+}
+
+func (s *scriptLens) Search(query string) ([]lens.Entry, error) {
+	return s.SearchContext(context.Background(), query)
+}
+
+func (s *scriptLens) SearchContext(ctx context.Context, query string) ([]lens.Entry, error) {
+	query = strings.TrimSpace(query)
+
+	if s.def.PerQuery {
+		return s.list(ctx, query)
+	}
+
+	entries, err := s.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []lens.Entry
+	for _, e := range entries {
+		if score, matches, ok := match.Match(query, e.Title); ok {
+			e.Score = score
+			e.Matches = matches
+			results = append(results, e)
+		}
+	}
+	return results, nil
+}
+
+// entries returns the command's output, running it if it hasn't been. The
+// command isn't tied to ctx, so that typing, which cancels each search for
+// the next, doesn't stop it before it's done.
+func (s *scriptLens) entries(ctx context.Context) ([]lens.Entry, error) {
+	s.mu.Lock()
+	l := s.listing
+	if l == nil {
+		l = &listing{done: make(chan struct{})}
+		s.listing = l
+
+		go func() {
+			l.entries, l.err = s.list(s.ctx, "")
+
+			// Failures are tried again on the next search
+			if l.err != nil {
+				s.mu.Lock()
+				if s.listing == l {
+					s.listing = nil
+				}
+				s.mu.Unlock()
+			}
+			close(l.done)
+		}()
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return l.entries, l.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// list runs the command and reads the entries it prints
+func (s *scriptLens) list(ctx context.Context, query string) ([]lens.Entry, error) {
+	command := expand(s.def.Command, lens.Entry{}, query)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	entries, err := s.parse(out)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		if entries[i].Icon == "" {
+			entries[i].Icon = s.def.Icon
+		}
+		if entries[i].Title == "" {
+			entries[i].Title = entries[i].ID
+		}
+		if entries[i].ID == "" {
+			entries[i].ID = entries[i].Title
+		}
+	}
+	return entries, nil
+}
+
+// parse reads the command's output in the lens's format
+func (s *scriptLens) parse(out []byte) ([]lens.Entry, error) {
+	var entries []lens.Entry
+
+	if s.def.Format == "json" {
+		// Either an array of entries, or one entry per line
+		dec := json.NewDecoder(bytes.NewReader(out))
+		for {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err == io.EOF {
+				return entries, nil
+			} else if err != nil {
+				return nil, err
+			}
+
+			if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+				var batch []lens.Entry
+				if err := json.Unmarshal(raw, &batch); err != nil {
+					return nil, err
+				}
+				entries = append(entries, batch...)
+				continue
+			}
+
+			var e lens.Entry
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		if s.def.Format == "lines" {
+			entries = append(entries, lens.Entry{ID: line, Title: line})
+			continue
+		}
+
+		var e lens.Entry
+		fields := strings.Split(line, "\t")
+		for i, column := range s.def.Columns {
+			if i >= len(fields) {
+				break
+			}
+			switch column {
+			case "id":
+				e.ID = fields[i]
+			case "title":
+				e.Title = fields[i]
+			case "icon":
+				e.Icon = fields[i]
+			case "description":
+				e.Description = fields[i]
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+func (s *scriptLens) Enter(entry lens.Entry) error {
+	if s.def.Enter == "" {
+		return nil
+	}
+	return run(expand(s.def.Enter, entry, ""))
+}
+
+func (s *scriptLens) ContextActions(entry lens.Entry) []lens.Action {
+	var actions []lens.Action
+	for _, a := range s.def.Actions {
+		command := a.Command
+		after := a.After
+		actions = append(actions, lens.Action{
+			Name:  a.Name,
+			After: after,
+			Run: func(e lens.Entry) error {
+				if after != lens.AfterRefresh {
+					return run(expand(command, e, ""))
+				}
+
+				// The list is searched again once this returns, so the
+				// command has to have finished changing it
+				out, err := exec.Command("sh", "-c", expand(command, e, "")).CombinedOutput()
+				if err != nil {
+					if msg := strings.TrimSpace(string(out)); msg != "" {
+						return fmt.Errorf("%w: %s", err, msg)
+					}
+					return err
+				}
+				s.Refresh()
+				return nil
+			},
+		})
+	}
+	return actions
+}
+
+// run starts command in the shell, detached so it outlives spyglass
+func run(command string) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	return cmd.Start()
+}
+
+// expand replaces the placeholders in command with the entry's fields and the
+// query. They're quoted for the shell, so they shouldn't be quoted in the
+// command.
+func expand(command string, e lens.Entry, query string) string {
+	return strings.NewReplacer(
+		"{id}", quote(e.ID),
+		"{title}", quote(e.Title),
+		"{description}", quote(e.Description),
+		"{query}", quote(query),
+	).Replace(command)
+}
+
+// quote quotes s as a single shell word
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -1,6 +1,7 @@
 package searxng
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 	"syscall"
 	"time"
 
+	spyglassconfig "github.com/indium114/spyglass/config"
 	"github.com/indium114/spyglass/lens"
 	"gopkg.in/yaml.v3"
 )
@@ -37,10 +39,6 @@ type searxLens struct {
 	mu sync.RWMutex
 
 	cfg config
-
-	results   []result
-	lastQuery string
-	searching bool
 }
 
 func New() lens.Lens {
@@ -53,11 +51,16 @@ func (l *searxLens) Name() string {
 	return "SearXNG"
 }
 
+func (l *searxLens) Keyword() string {
+	return "? "
+}
+
 func configPath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".config", "spyglass", "searxng", "config.yaml")
+	return filepath.Join(spyglassconfig.Dir(), "searxng", "config.yaml")
 }
 
+// loadConfig reads the lens's own config file. A "searxng" section in the
+// main config file takes precedence over it.
 func (l *searxLens) loadConfig() {
 	data, err := os.ReadFile(configPath())
 	if err != nil {
@@ -69,6 +72,20 @@ func (l *searxLens) loadConfig() {
 		return
 	}
 
+	l.setConfig(cfg)
+}
+
+func (l *searxLens) Configure(decode func(v any) error) error {
+	var cfg config
+	if err := decode(&cfg); err != nil {
+		return err
+	}
+
+	l.setConfig(cfg)
+	return nil
+}
+
+func (l *searxLens) setConfig(cfg config) {
 	if cfg.Limit <= 0 {
 		cfg.Limit = 25
 	}
@@ -79,43 +96,23 @@ func (l *searxLens) loadConfig() {
 }
 
 func (l *searxLens) Search(query string) ([]lens.Entry, error) {
-	query = strings.TrimSpace(query)
+	return lens.SearchContext(context.Background(), l, query)
+}
 
-	l.mu.Lock()
+func (l *searxLens) SearchStream(ctx context.Context, query string, push func([]lens.Entry)) error {
+	query = strings.TrimSpace(query)
 
-	// If empty query → clear results
+	// If empty query → no results
 	if query == "" {
-		l.results = nil
-		l.lastQuery = ""
-		l.searching = false
-		l.mu.Unlock()
-		return nil, nil
-	}
-
-	// If new query and not already searching → fire async request
-	if query != l.lastQuery && !l.searching {
-		l.lastQuery = query
-		l.searching = true
-		go l.performSearch(query)
+		return nil
 	}
 
-	resultsCopy := make([]result, len(l.results))
-	copy(resultsCopy, l.results)
-	l.mu.Unlock()
-
-	return l.buildEntries(resultsCopy), nil
-}
-
-func (l *searxLens) performSearch(query string) {
 	l.mu.RLock()
 	cfg := l.cfg
 	l.mu.RUnlock()
 
 	if cfg.IP == "" || cfg.Port == 0 {
-		l.mu.Lock()
-		l.searching = false
-		l.mu.Unlock()
-		return
+		return nil
 	}
 
 	endpoint := fmt.Sprintf(
@@ -125,22 +122,21 @@ func (l *searxLens) performSearch(query string) {
 		url.QueryEscape(query),
 	)
 
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
 	client := http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(endpoint)
+	resp, err := client.Do(req)
 	if err != nil {
-		l.mu.Lock()
-		l.searching = false
-		l.mu.Unlock()
-		return
+		return err
 	}
 	defer resp.Body.Close()
 
 	var parsed response
 	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		l.mu.Lock()
-		l.searching = false
-		l.mu.Unlock()
-		return
+		return err
 	}
 
 	limit := cfg.Limit
@@ -151,10 +147,8 @@ func (l *searxLens) performSearch(query string) {
 		parsed.Results = parsed.Results[:limit]
 	}
 
-	l.mu.Lock()
-	l.results = parsed.Results
-	l.searching = false
-	l.mu.Unlock()
+	push(l.buildEntries(parsed.Results))
+	return nil
 }
 
 func (l *searxLens) buildEntries(results []result) []lens.Entry {
@@ -196,7 +190,8 @@ func (l *searxLens) Enter(e lens.Entry) error {
 func (l *searxLens) ContextActions(e lens.Entry) []lens.Action {
 	return []lens.Action{
 		{
-			Name: "Copy URL",
+			Name:  "Copy URL",
+			After: lens.AfterStay,
 			Run: func(entry lens.Entry) error {
 				return copyToClipboard(entry.ID)
 			},
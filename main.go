@@ -1,19 +1,40 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"slices"
 	"strings"
+	"sync"
 
+	"github.com/indium114/spyglass/config"
+	"github.com/indium114/spyglass/daemon"
+	"github.com/indium114/spyglass/history"
 	"github.com/indium114/spyglass/lens"
-
+	"github.com/indium114/spyglass/lenses/all"
+	"github.com/indium114/spyglass/lenses/dmenu"
+	"github.com/indium114/spyglass/lenses/script"
+	"github.com/indium114/spyglass/plugin"
+	"github.com/indium114/spyglass/theme"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 )
 
 type viewState int
 
+// Height of the status line
+const statusHeight = 1
+
 const (
 	stateEntries viewState = iota
 	stateContext
@@ -22,6 +43,8 @@ const (
 type model struct {
 	lenses     []lens.Lens
 	activeLens int
+	// Keyword for each lens, or "" if it has none
+	keywords []string
 
 	search textinput.Model
 
@@ -41,78 +64,559 @@ type model struct {
 
 	// Cache entries for lazyloading
 	loadedEntries map[int][]lens.Entry
+
+	// In-flight search. Batches tagged with an older generation are stale
+	// and get discarded.
+	searchGen    int
+	cancelSearch context.CancelFunc
+	lastQuery    string
+	results      <-chan searchMsg
+	received     bool
+	loading      bool
+
+	// Initial search, dispatched from Init
+	startup tea.Cmd
+
+	history *history.Store
+
+	// When picking, Enter chooses entries for spyglass to print, rather than
+	// opening them. With acceptQuery, Enter on no results chooses the query.
+	pick        bool
+	acceptQuery bool
+	picked      []pickedEntry
+
+	// Entries marked to be opened or chosen together, in the order they were
+	// marked. With multi, the marker column is shown even if none are.
+	multi  bool
+	marked []lens.Entry
+
+	// Previews of entries, and the one for the selected entry
+	previews      *previewCache
+	previewKey    string
+	cancelPreview context.CancelFunc
+
+	// Status line message, cleared after a few seconds
+	status    string
+	statusErr bool
+	statusID  int
+
+	// The question being asked before running an action, if any
+	asking *question
+
+	// What the active lens is busy with, shown when there's no message, and
+	// whether it's being checked
+	lensStatus  string
+	pollingLens bool
+
+	keys     keyMap
+	help     help.Model
+	showHelp bool
+	layout   config.Layout
+	styles   styles
 }
 
-func newModel() model {
+func newModel(cfg config.Config, lenses []lens.Lens, keys keyMap, t theme.Theme, opts options) model {
 	ti := textinput.New()
 	ti.Placeholder = " Search..."
 	ti.Focus()
 	ti.CharLimit = 256
+	if opts.prompt != "" {
+		ti.Prompt = opts.prompt + " "
+	}
+
+	// Picking several entries has to be asked for, since whatever reads
+	// them may expect one
+	marking := opts.multi || !opts.picking()
+	keys.Toggle.SetEnabled(marking)
+	keys.ToggleAll.SetEnabled(marking)
+	keys.EnterStay.SetEnabled(!opts.picking())
+
+	// Picking from standard input shouldn't affect, or be affected by, what
+	// was launched before
+	hist := history.Load()
+	if opts.dmenu {
+		hist = history.Empty()
+	}
+
+	keywords := make([]string, len(lenses))
+	for i, l := range lenses {
+		if kw, ok := cfg.Keyword(l.Name()); ok {
+			keywords[i] = kw
+		} else if k, ok := l.(lens.Keyworder); ok {
+			keywords[i] = k.Keyword()
+		}
+	}
 
 	m := model{
-		lenses:        Lenses,
+		lenses:        lenses,
+		keywords:      keywords,
 		search:        ti,
 		loadedEntries: make(map[int][]lens.Entry),
 		selected:      0,
 		scroll:        0,
 		state:         stateEntries,
+		history:       hist,
+		pick:          opts.picking(),
+		acceptQuery:   opts.dmenu,
+		multi:         opts.multi,
+		previews:      newPreviewCache(),
+		keys:          keys,
+		help:          newHelp(t),
+		layout:        cfg.Layout,
+		styles:        newStyles(t),
+	}
+
+	for i, l := range lenses {
+		if strings.EqualFold(l.Name(), cfg.DefaultLens) {
+			m.activeLens = i
+		}
+	}
+
+	// A query starting with a keyword starts in that keyword's lens
+	query := opts.query
+	if i, rest, ok := m.matchKeyword(query); ok {
+		m.activeLens = i
+		query = rest
 	}
-	m.refresh()
+	m.search.SetValue(query)
+	m.search.CursorEnd()
+
+	m.startup = m.refresh()
 	return m
 }
 
-func (m *model) refresh() {
-	if m.state == stateEntries {
-		query := strings.TrimSpace(m.search.Value())
+// configureLenses hands each registered lens its section of the config
+func configureLenses(cfg config.Config) error {
+	for _, l := range Lenses {
+		c, ok := l.(lens.Configurable)
+		if !ok {
+			continue
+		}
+		if decode, ok := cfg.LensSection(l.Name()); ok {
+			if err := c.Configure(decode); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
-		entries, _ := m.lenses[m.activeLens].Search(query)
+// The lenses localLenses loaded, for closeLenses to close
+var loadedLenses []lens.Lens
 
-		if query == "" {
-			entries, _ = m.lenses[m.activeLens].Search("")
+// localLenses configures every registered lens, reads the script lenses,
+// starts the plugins in cfg, and returns them all. Script lenses and plugins
+// that fail to load are left out.
+func localLenses(cfg config.Config) ([]lens.Lens, error) {
+	if err := configureLenses(cfg); err != nil {
+		return nil, err
+	}
+
+	lenses := slices.Clone(Lenses)
+
+	scripts, errs := script.Load(config.LensesDir())
+	for _, err := range errs {
+		log.Println(err)
+	}
+	lenses = append(lenses, scripts...)
+
+	for _, p := range cfg.Plugins {
+		l, err := plugin.New(p)
+		if err != nil {
+			log.Println(err)
+			continue
 		}
+		lenses = append(lenses, l)
+	}
 
-		m.entries = entries
+	loadedLenses = lenses
+	return lenses, nil
+}
 
-		if m.selected >= len(m.entries) {
-			m.selected = len(m.entries) - 1
+// closeLenses stops what the lenses loaded here are doing in the background,
+// like indexing, and stops the plugins. They're closed all at once, since
+// some wait for work to finish.
+func closeLenses() {
+	var wg sync.WaitGroup
+	for _, l := range loadedLenses {
+		if c, ok := l.(io.Closer); ok {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = c.Close()
+			}()
 		}
-		if m.selected < 0 {
-			m.selected = 0
+	}
+	wg.Wait()
+}
+
+// enabledLenses returns the lenses to show, in tab order. They're served by
+// the daemon if it's running, and loaded here otherwise.
+func enabledLenses(cfg config.Config, opts options) ([]lens.Lens, error) {
+	var available []lens.Lens
+	if !opts.noDaemon {
+		available, _ = daemon.Connect(daemon.SocketPath())
+	}
+	if available == nil {
+		var err error
+		available, err = localLenses(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(opts.only) > 0 {
+		lenses, err := pickLenses(available, opts.only)
+		if err != nil {
+			return nil, fmt.Errorf("--only: %w", err)
 		}
+		return lenses, nil
+	}
+
+	lenses, err := pickLenses(available, cfg.Lenses)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", config.Path(), err)
 	}
+	return lenses, nil
+}
+
+// pickLenses returns the lenses from available with the given names, in that
+// order. With no names, every lens is picked, after All. All searches the
+// other lenses picked, or every lens if it's picked alone, so that disabled
+// lenses never run.
+func pickLenses(available []lens.Lens, names []string) ([]lens.Lens, error) {
+	if len(names) == 0 {
+		return append([]lens.Lens{all.New(available)}, available...), nil
+	}
+
+	// All is filled in once the lenses it searches are known
+	var lenses []lens.Lens
+	for _, name := range names {
+		if strings.EqualFold(name, all.Name) {
+			lenses = append(lenses, nil)
+			continue
+		}
+
+		i := slices.IndexFunc(available, func(l lens.Lens) bool {
+			return strings.EqualFold(l.Name(), name)
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("unknown lens %q", name)
+		}
+		lenses = append(lenses, available[i])
+	}
+
+	if i := slices.Index(lenses, nil); i >= 0 {
+		searched := slices.DeleteFunc(slices.Clone(lenses), func(l lens.Lens) bool {
+			return l == nil
+		})
+		if len(searched) == 0 {
+			searched = available
+		}
+		lenses[i] = all.New(searched)
+		lenses = slices.DeleteFunc(lenses, func(l lens.Lens) bool {
+			return l == nil
+		})
+	}
+	return lenses, nil
+}
+
+func (m *model) switchLens(i int) tea.Cmd {
+	m.activeLens = i
+	m.state = stateEntries
+	m.marked = nil
+	m.lensStatus = ""
+	m.entries = nil
+	m.selected = 0
+	m.scroll = 0
+	return m.refresh()
+}
+
+// matchKeyword checks whether query starts with a lens's keyword, returning
+// that lens and the rest of the query. The longest matching keyword wins.
+func (m *model) matchKeyword(query string) (int, string, bool) {
+	best := -1
+	for i, kw := range m.keywords {
+		if kw != "" && strings.HasPrefix(query, kw) && (best < 0 || len(kw) > len(m.keywords[best])) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0, "", false
+	}
+	return best, strings.TrimPrefix(query, m.keywords[best]), true
+}
+
+// rows returns the number of rows in the list being shown
+func (m *model) rows() int {
+	if m.state == stateContext {
+		return len(m.actions)
+	}
+	return len(m.entries)
+}
+
+// move moves the selection by delta rows, stopping at either end of the list
+func (m *model) move(delta int) {
+	selected := &m.selected
+	if m.state == stateContext {
+		selected = &m.contextSelected
+	}
+
+	*selected = max(min(*selected+delta, m.rows()-1), 0)
+}
+
+// isMarked reports whether the entry with the given ID is marked
+func (m model) isMarked(id string) bool {
+	return slices.ContainsFunc(m.marked, func(e lens.Entry) bool {
+		return e.ID == id
+	})
+}
+
+// toggleMark marks or unmarks an entry
+func (m *model) toggleMark(entry lens.Entry) {
+	i := slices.IndexFunc(m.marked, func(e lens.Entry) bool {
+		return e.ID == entry.ID
+	})
+	if i >= 0 {
+		m.marked = slices.Delete(m.marked, i, i+1)
+	} else {
+		m.marked = append(m.marked, entry)
+	}
+}
+
+// toggleAll marks every result, or unmarks them all if they're all marked
+func (m *model) toggleAll() {
+	all := !slices.ContainsFunc(m.entries, func(e lens.Entry) bool {
+		return !m.isMarked(e.ID)
+	})
+
+	for _, e := range m.entries {
+		if m.isMarked(e.ID) == all {
+			m.toggleMark(e)
+		}
+	}
+}
+
+// choose returns the entries that Enter picks: the marked entries if there
+// are any, otherwise the selected one
+func (m model) choose() []lens.Entry {
+	switch {
+	case len(m.marked) > 0:
+		return m.marked
+	case len(m.entries) > 0:
+		return []lens.Entry{m.entries[m.selected]}
+	case m.acceptQuery && m.search.Value() != "":
+		return []lens.Entry{{ID: "-1", Title: m.search.Value()}}
+	}
+	return nil
+}
+
+// open opens the marked entries if there are any, otherwise the selected one,
+// and records them in the history. It returns what was opened, for the status
+// line, or a command showing why it failed.
+func (m *model) open() (string, tea.Cmd) {
+	l := m.lenses[m.activeLens]
+
+	entries := m.marked
+	var err error
+	switch {
+	case len(entries) > 0:
+		err = lens.EnterBatch(l, entries)
+	case len(m.entries) > 0:
+		entries = []lens.Entry{m.entries[m.selected]}
+		err = l.Enter(entries[0])
+	default:
+		return "", nil
+	}
+	if err != nil {
+		return "", m.reportError(l.Name(), err)
+	}
+
+	for _, entry := range entries {
+		origin, e := lens.Origin(l, entry)
+		if err := m.history.Record(origin.Name(), e.ID); err != nil {
+			log.Println("history:", err)
+		}
+	}
+
+	if len(entries) == 1 {
+		return entries[0].Title, nil
+	}
+	return fmt.Sprintf("%d entries", len(entries)), nil
+}
+
+// listHeight returns the height of the results box, including its borders
+func (m model) listHeight() int {
+	listHeight := m.height - 1 - statusHeight - m.layout.Tabs - m.layout.Description - m.layout.Search
+	if listHeight < 3 {
+		listHeight = 3
+	}
+	return listHeight
+}
+
+// visibleRows returns how many rows of results fit on screen
+func (m model) visibleRows() int {
+	return max(m.listHeight()-2, 1)
+}
+
+// runAction runs a context action on the entry it was opened for, or its
+// input's Run with text, and then does what the action asks. With stay,
+// spyglass stays open even if the action would close it.
+func (m *model) runAction(action lens.Action, text string, stay bool) tea.Cmd {
+	var err error
+	if action.Input != nil {
+		err = action.Input.Run(m.contextFor, text)
+	} else {
+		err = action.Run(m.contextFor)
+	}
+	if err != nil {
+		return m.reportError(action.Name, err)
+	}
+
+	after := action.After
+	if stay && after == lens.AfterClose {
+		after = lens.AfterStay
+	}
+
+	switch after {
+	case lens.AfterRefresh:
+		m.state = stateEntries
+		m.marked = nil
+		m.previews = newPreviewCache()
+		m.previewKey = ""
+		return m.refresh()
+	case lens.AfterStay:
+		return m.setStatus(action.Name+": done", false)
+	default:
+		return m.quit()
+	}
+}
+
+func (m *model) quit() tea.Cmd {
+	if m.cancelSearch != nil {
+		m.cancelSearch()
+	}
+	if m.cancelPreview != nil {
+		m.cancelPreview()
+	}
+	return tea.Quit
 }
 
 func (m model) Init() tea.Cmd {
-	return textinput.Blink
+	return tea.Batch(textinput.Blink, m.startup)
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	m, cmd := m.update(msg)
+
+	// Whatever changed, keep the preview in step with the selection. It's
+	// loaded before returning m, since loading changes it.
+	preview := m.loadPreview()
+	return m, tea.Batch(cmd, preview)
+}
+
+func (m model) update(msg tea.Msg) (model, tea.Cmd) {
+	var cmds []tea.Cmd
+
 	switch msg := msg.(type) {
 
+	case searchMsg:
+		return m, m.receive(msg)
+
+	case previewMsg:
+		m.receivePreview(msg)
+		return m, nil
+
+	case clearStatusMsg:
+		if msg.id == m.statusID {
+			m.status = ""
+		}
+		return m, nil
+
+	case lensStatusMsg:
+		return m, m.receiveLensStatus(msg)
+
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
 
 	case tea.KeyMsg:
-		switch msg.Type {
+		// A question before an action takes over the search box
+		if m.asking != nil {
+			return m, m.answer(msg)
+		}
+
+		// Keys bound to an action aren't passed on to the search box
+		handled := true
+
+		switch {
+
+		case key.Matches(msg, m.keys.Quit):
+			return m, m.quit()
+
+		case m.showHelp && key.Matches(msg, m.keys.Help, m.keys.Back):
+			m.showHelp = false
+
+		case m.showHelp:
+			// Swallow everything else while the help is shown
 
-		case tea.KeyCtrlC:
-			return m, tea.Quit
+		case m.pick && m.state == stateEntries && key.Matches(msg, m.keys.Back):
+			// Cancel
+			return m, m.quit()
 
-		case tea.KeyTab:
-			// Switch lens
-			m.activeLens = (m.activeLens + 1) % len(m.lenses)
-			if m.activeLens < 0 {
-				m.activeLens = len(m.lenses) - 1
+		case m.pick && m.state == stateEntries && key.Matches(msg, m.keys.Enter):
+			if picked := m.choose(); len(picked) > 0 {
+				l := m.lenses[m.activeLens]
+				for _, entry := range picked {
+					origin, e := lens.Origin(l, entry)
+					m.picked = append(m.picked, pickedEntry{Lens: origin.Name(), Entry: e})
+				}
+				return m, m.quit()
 			}
-			m.state = stateEntries
-			m.selected = 0
-			m.scroll = 0
-			m.refresh()
 
-		case tea.KeyShiftTab:
-			// Open context menu
+		case key.Matches(msg, m.keys.Toggle):
 			if m.state == stateEntries && len(m.entries) > 0 {
+				m.toggleMark(m.entries[m.selected])
+				m.move(1)
+			}
+
+		case key.Matches(msg, m.keys.ToggleAll):
+			if m.state == stateEntries {
+				m.toggleAll()
+			}
+
+		case key.Matches(msg, m.keys.Help):
+			m.showHelp = true
+
+		case key.Matches(msg, m.keys.NextLens):
+			cmds = append(cmds, m.switchLens((m.activeLens+1)%len(m.lenses)))
+
+		case key.Matches(msg, m.keys.PrevLens):
+			cmds = append(cmds, m.switchLens((m.activeLens+len(m.lenses)-1)%len(m.lenses)))
+
+		case key.Matches(msg, m.keys.ContextMenu):
+			// Open context menu, for the marked entries if there are any
+			if m.state == stateEntries && len(m.marked) > 0 {
+				marked := m.marked
+				var actions []lens.Action
+				for _, a := range lens.BatchActions(m.lenses[m.activeLens], marked) {
+					actions = append(actions, lens.Action{
+						Name:    a.Name,
+						After:   a.After,
+						Confirm: a.Confirm,
+						Run: func(lens.Entry) error {
+							return a.Run(marked)
+						},
+					})
+				}
+
+				if len(actions) > 0 {
+					m.actions = actions
+					m.state = stateContext
+					m.contextSelected = 0
+					m.contextScroll = 0
+				}
+			} else if m.state == stateEntries && len(m.entries) > 0 {
 				entry := m.entries[m.selected]
 				actions := m.lenses[m.activeLens].ContextActions(entry)
 
@@ -125,52 +629,106 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			}
 
-		case tea.KeyUp:
-			if m.state == stateEntries {
-				if m.selected > 0 {
-					m.selected--
-				}
-			} else if m.state == stateContext {
-				if m.contextSelected > 0 {
-					m.contextSelected--
-				}
-			}
+		case key.Matches(msg, m.keys.Up):
+			m.move(-1)
+
+		case key.Matches(msg, m.keys.Down):
+			m.move(1)
+
+		case key.Matches(msg, m.keys.PageUp):
+			m.move(-m.visibleRows())
+
+		case key.Matches(msg, m.keys.PageDown):
+			m.move(m.visibleRows())
+
+		case key.Matches(msg, m.keys.Home):
+			m.move(-m.rows())
+
+		case key.Matches(msg, m.keys.End):
+			m.move(m.rows())
+
+		case key.Matches(msg, m.keys.Enter, m.keys.EnterStay):
+			stay := key.Matches(msg, m.keys.EnterStay)
 
-		case tea.KeyDown:
 			if m.state == stateEntries {
-				if m.selected < len(m.entries)-1 {
-					m.selected++
+				opened, cmd := m.open()
+				switch {
+				case cmd != nil:
+					// Stay open, so the error can be read
+					cmds = append(cmds, cmd)
+				case opened == "":
+				case !stay:
+					return m, m.quit()
+				default:
+					m.marked = nil
+					cmds = append(cmds, m.setStatus("Opened "+opened, false))
 				}
-			} else if m.state == stateContext {
-				if m.contextSelected < len(m.actions)-1 {
-					m.contextSelected++
+			} else if m.state == stateContext && len(m.actions) > 0 {
+				action := m.actions[m.contextSelected]
+				if action.Input != nil || action.Confirm != "" {
+					m.ask(action, stay)
+				} else {
+					cmds = append(cmds, m.runAction(action, "", stay))
 				}
 			}
 
-		case tea.KeyEnter:
-			if m.state == stateEntries && len(m.entries) > 0 {
-				entry := m.entries[m.selected]
-				m.lenses[m.activeLens].Enter(entry)
-				return m, tea.Quit
-			} else if m.state == stateContext && len(m.actions) > 0 {
-				m.actions[m.contextSelected].Run(m.contextFor)
-				m.state = stateEntries
-				m.selected = 0
-				m.scroll = 0
-				return m, tea.Quit
-			}
+		case m.state == stateEntries && len(m.marked) > 0 && key.Matches(msg, m.keys.Back):
+			m.marked = nil
 
-		case tea.KeyEsc:
+		case key.Matches(msg, m.keys.Back):
 			m.state = stateEntries
 			m.selected = 0
 			m.scroll = 0
+
+		default:
+			handled = false
+		}
+
+		if handled {
+			return m, tea.Batch(cmds...)
 		}
 	}
 
 	var cmd tea.Cmd
 	m.search, cmd = m.search.Update(msg)
-	m.refresh()
-	return m, cmd
+	cmds = append(cmds, cmd)
+
+	// Typing a lens's keyword jumps to it
+	if i, rest, ok := m.matchKeyword(m.search.Value()); ok {
+		m.search.SetValue(rest)
+		cmds = append(cmds, m.switchLens(i))
+	} else if strings.TrimSpace(m.search.Value()) != m.lastQuery {
+		cmds = append(cmds, m.refresh())
+	}
+
+	return m, tea.Batch(cmds...)
+}
+
+// statusLine renders the status message, with the number of results, and of
+// marked entries, on the right
+func (m model) statusLine() string {
+	width := m.width - 2
+
+	count := fmt.Sprintf("%d results", len(m.entries))
+	if len(m.entries) == 1 {
+		count = "1 result"
+	}
+	if len(m.marked) > 0 {
+		count = fmt.Sprintf("%d marked · %s", len(m.marked), count)
+	}
+	count = m.styles.badge.Render(count)
+
+	text, style := m.status, m.styles.badge
+	if m.statusErr {
+		style = m.styles.err
+	}
+	if text == "" {
+		text = m.lensStatus
+	}
+	status := style.Render(ansi.Truncate(text, max(width-lipgloss.Width(count)-1, 0), "…"))
+
+	gap := max(width-lipgloss.Width(status)-lipgloss.Width(count), 1)
+	return " " + status + strings.Repeat(" ", gap) + count
 }
 
 func (m model) View() string {
@@ -178,44 +736,49 @@ func (m model) View() string {
 		return ""
 	}
 
-	border := lipgloss.RoundedBorder()
+	border := m.styles.border
 
 	// Compute available space properly
-	tabHeight := 3
-	descHeight := 5
-	searchHeight := 3
+	tabHeight := m.layout.Tabs
+	descHeight := m.layout.Description
+	searchHeight := m.layout.Search
 
-	listHeight := m.height - 1 - tabHeight - descHeight - searchHeight
-	if listHeight < 3 {
-		listHeight = 3
-	}
+	listHeight := m.listHeight()
 
 	contentWidth := m.width - 2
 
+	// The preview pane takes its share of the width from the results
+	listWidth := contentWidth
+	previewWidth := 0
+	if m.previewShown() {
+		previewWidth = m.width * min(m.layout.Preview, 90) / 100
+		listWidth = m.width - previewWidth - 2
+	}
+
 	tabStyle := lipgloss.NewStyle().
 		Border(border).
-		BorderForeground(lipgloss.Color("#313244")).
+		BorderForeground(m.styles.borderColor).
 		Width(contentWidth).
 		Height(tabHeight-2).
 		Padding(0, 1)
 
 	listStyle := lipgloss.NewStyle().
 		Border(border).
-		BorderForeground(lipgloss.Color("#313244")).
-		Width(contentWidth).
+		BorderForeground(m.styles.borderColor).
+		Width(listWidth).
 		Height(listHeight-2).
 		Padding(0, 1)
 
 	descStyle := lipgloss.NewStyle().
 		Border(border).
-		BorderForeground(lipgloss.Color("#313244")).
+		BorderForeground(m.styles.borderColor).
 		Width(contentWidth).
 		Height(descHeight-2).
 		Padding(0, 1)
 
 	searchStyle := lipgloss.NewStyle().
 		Border(border).
-		BorderForeground(lipgloss.Color("#cba6f7")).
+		BorderForeground(m.styles.activeBorder).
 		Width(contentWidth).
 		Height(searchHeight-2).
 		Padding(0, 1)
@@ -223,26 +786,37 @@ func (m model) View() string {
 	// Tabs
 	var tabs []string
 	for i, l := range m.lenses {
+		var tab string
 		if i == m.activeLens {
-			tabs = append(tabs, lipgloss.NewStyle().
-				Foreground(lipgloss.Color("#cba6f7")).
-				Bold(true).
-				Render("["+l.Name()+"]"))
+			name := l.Name()
+			if m.loading {
+				name += " 󰔟"
+			}
+			tab = m.styles.activeTab.Render("[" + name + "]")
 		} else {
-			tabs = append(tabs, l.Name())
+			tab = l.Name()
+		}
+
+		if kw := strings.TrimSpace(m.keywords[i]); kw != "" {
+			tab += " " + m.styles.badge.Render(kw)
 		}
+		tabs = append(tabs, tab)
 	}
 	tabsBox := tabStyle.Render(strings.Join(tabs, " | "))
 
 	// LIST CONTENT
 	var listBuilder strings.Builder
 
-	maxVisible := listHeight - 2
-	if maxVisible < 1 {
-		maxVisible = 1
-	}
+	// Rows are truncated rather than wrapped, inside the horizontal padding
+	rowWidth := listWidth - 2
 
-	if m.state == stateContext {
+	maxVisible := m.visibleRows()
+
+	if m.showHelp {
+		m.help.Width = rowWidth
+		listBuilder.WriteString(m.help.View(m.keys))
+
+	} else if m.state == stateContext {
 		// Keep selected within visible window
 		if m.contextSelected < m.contextScroll {
 			m.contextScroll = m.contextSelected
@@ -258,11 +832,7 @@ func (m model) View() string {
 		}
 
 		for i := start; i < end; i++ {
-			cursor := "  "
-			if i == m.contextSelected {
-				cursor = "> "
-			}
-			listBuilder.WriteString(cursor + m.actions[i].Name + "\n")
+			listBuilder.WriteString(m.styles.renderRow(m.actions[i].Name, i == m.contextSelected, rowWidth) + "\n")
 		}
 
 	} else {
@@ -280,22 +850,31 @@ func (m model) View() string {
 		}
 
 		for i := start; i < end; i++ {
-			cursor := "  "
-			if i == m.selected {
-				cursor = "> "
+			e := m.entries[i]
+
+			marker := ""
+			if m.multi || len(m.marked) > 0 {
+				marker = m.styles.renderMarker(m.isMarked(e.ID))
 			}
-			listBuilder.WriteString(
-				fmt.Sprintf("%s%s %s\n",
-					cursor,
-					m.entries[i].Icon,
-					m.entries[i].Title,
-				),
-			)
+			listBuilder.WriteString(m.styles.renderEntry(e, i == m.selected, marker, rowWidth) + "\n")
 		}
 	}
 
 	listBox := listStyle.Render(listBuilder.String())
 
+	if previewWidth > 0 {
+		previewStyle := lipgloss.NewStyle().
+			Border(border).
+			BorderForeground(m.styles.borderColor).
+			Width(previewWidth-2).
+			Height(listHeight-2).
+			MaxHeight(listHeight).
+			Padding(0, 1)
+
+		preview := m.renderPreview(previewWidth-4, listHeight-2)
+		listBox = lipgloss.JoinHorizontal(lipgloss.Top, listBox, previewStyle.Render(preview))
+	}
+
 	// Description
 	var desc string
 
@@ -309,7 +888,7 @@ func (m model) View() string {
 		}
 	}
 
-	descBox := descStyle.Render(desc)
+	descBox := descStyle.Inherit(m.styles.description).Render(desc)
 
 	searchBox := searchStyle.Render(m.search.View())
 
@@ -318,14 +897,104 @@ func (m model) View() string {
 		tabsBox,
 		listBox,
 		descBox,
+		m.statusLine(),
 		searchBox,
 	)
 }
 
 func main() {
-	p := tea.NewProgram(newModel())
-	if err := p.Start(); err != nil {
-		fmt.Println("Error:", err)
-		os.Exit(1)
+	if len(os.Args) > 1 {
+		if command, ok := subcommands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				exitWithError(err)
+			}
+			return
+		}
+	}
+
+	opts, err := parseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		// The error has already been printed, with usage
+		os.Exit(2)
+	}
+
+	logFile := setupLog()
+	defer logFile.Close()
+
+	cfg, err := config.Load()
+	if err != nil {
+		exitWithError(err)
+	}
+
+	var lenses []lens.Lens
+	if opts.dmenu {
+		items, err := dmenu.Read(os.Stdin)
+		if err != nil {
+			exitWithError(err)
+		}
+		lenses = []lens.Lens{dmenu.New(items)}
+	} else {
+		lenses, err = enabledLenses(cfg, opts)
+		if err != nil {
+			exitWithError(err)
+		}
+	}
+
+	if opts.lens != "" {
+		if !slices.ContainsFunc(lenses, func(l lens.Lens) bool {
+			return strings.EqualFold(l.Name(), opts.lens)
+		}) {
+			exitWithError(fmt.Errorf("--lens: lens %q isn't shown", opts.lens))
+		}
+		cfg.DefaultLens = opts.lens
+	}
+
+	t, err := theme.Load(config.ThemesDir(), cfg.Theme.Name)
+	if err == nil {
+		t = t.Override(cfg.Theme.Theme)
+		err = t.Validate()
+	}
+	if err != nil {
+		exitWithError(err)
+	}
+
+	keys, err := newKeyMap(cfg.Keys)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	var programOpts []tea.ProgramOption
+	if opts.picking() {
+		// Standard input and output carry the items and the choice, so the
+		// interface talks to the terminal directly
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			exitWithError(err)
+		}
+		defer tty.Close()
+
+		programOpts = append(programOpts, tea.WithInput(tty), tea.WithOutput(os.Stderr))
+		lipgloss.SetDefaultRenderer(lipgloss.NewRenderer(os.Stderr))
+	}
+
+	p := tea.NewProgram(newModel(cfg, lenses, keys, t, opts), programOpts...)
+	final, err := p.Run()
+	closeLenses()
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if opts.picking() {
+		picked := final.(model).picked
+		if len(picked) == 0 {
+			// Cancelled
+			os.Exit(1)
+		}
+		if err := printPicked(opts, picked); err != nil {
+			exitWithError(err)
+		}
 	}
 }
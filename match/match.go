@@ -0,0 +1,283 @@
+// Package match implements fzf-style fuzzy matching for lenses.
+//
+// A pattern matches a text if all of its runes appear in the text in order.
+// Matches are scored so that runes at the start of words, after path
+// separators and at camelCase humps count for more, and gaps count against.
+package match
+
+import (
+	"unicode"
+)
+
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+
+	// Bonus for a match at the start of a word, after whitespace
+	bonusBoundaryWhite = scoreMatch / 2
+	// Bonus for a match after a delimiter like '/' or ':'
+	bonusBoundaryDelimiter = bonusBoundaryWhite - 1
+	// Bonus for a match after any other non-word character
+	bonusBoundary = bonusBoundaryWhite - 2
+	// Bonus for a camelCase hump or the first digit of a number
+	bonusCamel = bonusBoundary - 1
+	// Bonus for each run of consecutive matches
+	bonusConsecutive = -(scoreGapStart + scoreGapExtension)
+	// The first rune of the pattern counts more towards the score
+	bonusFirstCharMultiplier = 2
+
+	// Above this many DP cells, fall back to a greedy match
+	maxCells = 1 << 16
+)
+
+type charClass int
+
+const (
+	classWhite charClass = iota
+	classNonWord
+	classDelimiter
+	classLower
+	classUpper
+	classLetter
+	classNumber
+)
+
+func classOf(r rune) charClass {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return classLower
+	case r >= 'A' && r <= 'Z':
+		return classUpper
+	case r >= '0' && r <= '9':
+		return classNumber
+	case unicode.IsSpace(r):
+		return classWhite
+	case r == '/' || r == '\\' || r == ',' || r == ':' || r == ';' || r == '|' || r == '-' || r == '_' || r == '.':
+		return classDelimiter
+	case unicode.IsLower(r):
+		return classLower
+	case unicode.IsUpper(r):
+		return classUpper
+	case unicode.IsLetter(r):
+		return classLetter
+	case unicode.IsNumber(r):
+		return classNumber
+	}
+	return classNonWord
+}
+
+func bonusFor(prev, cur charClass) int {
+	if cur > classDelimiter {
+		switch prev {
+		case classWhite:
+			return bonusBoundaryWhite
+		case classDelimiter:
+			return bonusBoundaryDelimiter
+		case classNonWord:
+			return bonusBoundary
+		}
+	}
+
+	if prev == classLower && cur == classUpper ||
+		prev != classNumber && cur == classNumber {
+		return bonusCamel
+	}
+
+	return 0
+}
+
+// Match fuzzy-matches pattern against text.
+//
+// Matching is case-insensitive unless pattern contains an uppercase letter.
+// It returns the match's score (higher is better) and the rune indexes of
+// text that were matched. An empty pattern matches everything with a score
+// of zero.
+func Match(pattern, text string) (score int, positions []int, ok bool) {
+	p := []rune(pattern)
+	if len(p) == 0 {
+		return 0, nil, true
+	}
+
+	caseSensitive := false
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			caseSensitive = true
+			break
+		}
+	}
+	if !caseSensitive {
+		for i, r := range p {
+			p[i] = unicode.ToLower(r)
+		}
+	}
+
+	t := []rune(text)
+	folded := t
+	if !caseSensitive {
+		folded = make([]rune, len(t))
+		for i, r := range t {
+			folded[i] = unicode.ToLower(r)
+		}
+	}
+
+	// Find the window the match can happen in: from the first occurrence
+	// of the first rune, to the last occurrence of the last rune
+	first, pi := -1, 0
+	for i, r := range folded {
+		if r == p[pi] {
+			if pi == 0 {
+				first = i
+			}
+			pi++
+			if pi == len(p) {
+				break
+			}
+		}
+	}
+	if pi < len(p) {
+		return 0, nil, false
+	}
+
+	last := len(folded) - 1
+	for folded[last] != p[len(p)-1] {
+		last--
+	}
+
+	bonus := make([]int, len(t))
+	prev := classWhite
+	for i, r := range t {
+		cur := classOf(r)
+		bonus[i] = bonusFor(prev, cur)
+		prev = cur
+	}
+
+	window := folded[first : last+1]
+	if len(window)*len(p) > maxCells {
+		return greedy(p, folded, bonus, first)
+	}
+
+	return align(p, window, bonus[first:last+1], first)
+}
+
+// align finds the highest-scoring alignment of pattern within window using
+// dynamic programming, like fzf's v2 algorithm
+func align(pattern, window []rune, bonus []int, offset int) (int, []int, bool) {
+	const none = -1 << 30
+
+	m, n := len(pattern), len(window)
+
+	// score[i][j] is the best score with pattern[i] matched at window[j],
+	// and from[i][j] is where pattern[i-1] was matched in that alignment
+	score := make([][]int, m)
+	from := make([][]int, m)
+	// run[i][j] is the bonus of the first rune of the consecutive run that
+	// ends at window[j], so a run keeps the bonus of the boundary it began at
+	run := make([][]int, m)
+
+	for i := range m {
+		score[i] = make([]int, n)
+		from[i] = make([]int, n)
+		run[i] = make([]int, n)
+
+		// Best alignment of pattern[:i] ending before a gap, and where it ended
+		gapScore, gapFrom := none, -1
+
+		for j := range n {
+			score[i][j] = none
+
+			if i > 0 && j >= 2 {
+				// Extend the gap, or open a new one after window[j-2]
+				if gapScore != none {
+					gapScore += scoreGapExtension
+				}
+				if s := score[i-1][j-2]; s != none && s+scoreGapStart > gapScore {
+					gapScore, gapFrom = s+scoreGapStart, j-2
+				}
+			}
+
+			if window[j] != pattern[i] {
+				continue
+			}
+
+			b := bonus[j]
+			if i == 0 {
+				score[i][j] = scoreMatch + b*bonusFirstCharMultiplier
+				from[i][j] = -1
+				run[i][j] = b
+				continue
+			}
+
+			best, bestFrom, bestRun := none, -1, b
+
+			if gapScore != none {
+				best, bestFrom = gapScore+scoreMatch+b, gapFrom
+			}
+
+			if j > 0 && score[i-1][j-1] != none {
+				// Consecutive runs carry the boundary bonus of their first rune
+				rb := max(run[i-1][j-1], bonusConsecutive, b)
+				if s := score[i-1][j-1] + scoreMatch + rb; s > best {
+					best, bestFrom, bestRun = s, j-1, rb
+				}
+			}
+
+			score[i][j] = best
+			from[i][j] = bestFrom
+			run[i][j] = bestRun
+		}
+	}
+
+	end, total := -1, none
+	for j, s := range score[m-1] {
+		if s > total {
+			end, total = j, s
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	positions := make([]int, m)
+	for i, j := m-1, end; i >= 0; i-- {
+		positions[i] = j + offset
+		j = from[i][j]
+	}
+
+	return total, positions, true
+}
+
+// greedy matches each rune of pattern at its first possible position. It's
+// used for long texts, where the full alignment would be too expensive.
+func greedy(pattern, text []rune, bonus []int, start int) (int, []int, bool) {
+	positions := make([]int, 0, len(pattern))
+	total := 0
+	prev := -2
+
+	pi := 0
+	for i := start; i < len(text) && pi < len(pattern); i++ {
+		if text[i] != pattern[pi] {
+			continue
+		}
+
+		s := scoreMatch + bonus[i]
+		switch {
+		case pi == 0:
+			s = scoreMatch + bonus[i]*bonusFirstCharMultiplier
+		case i == prev+1:
+			s += bonusConsecutive
+		default:
+			s += scoreGapStart + scoreGapExtension*(i-prev-2)
+		}
+
+		total += s
+		positions = append(positions, i)
+		prev = i
+		pi++
+	}
+
+	if pi < len(pattern) {
+		return 0, nil, false
+	}
+	return total, positions, true
+}
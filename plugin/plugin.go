@@ -0,0 +1,209 @@
+// Package plugin runs lenses written as separate programs, in any language.
+//
+// spyglass starts the program and speaks JSON-RPC 2.0 to it, one message per
+// line on its standard input and output. A plugin that crashes, or takes too
+// long to answer, is stopped and started again on the next request.
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/indium114/spyglass/config"
+	"github.com/indium114/spyglass/lens"
+)
+
+// How long a plugin gets to answer, unless configured
+const defaultTimeout = 5 * time.Second
+
+// A plugin started this many times within restartWindow isn't started again
+// until the window has passed
+const (
+	maxStarts     = 4
+	restartWindow = time.Minute
+)
+
+// How long a plugin gets to exit once its standard input is closed
+const stopGrace = 2 * time.Second
+
+type pluginLens struct {
+	name    string
+	command string
+	timeout time.Duration
+
+	mu     sync.Mutex
+	proc   *process
+	starts []time.Time
+	// Set by Close, after which the plugin isn't started again
+	closed bool
+}
+
+type action struct {
+	Name  string     `json:"name"`
+	After lens.After `json:"after"`
+}
+
+// New returns the lens provided by a plugin. If the plugin's name isn't
+// configured, the plugin is started to ask for it.
+func New(cfg config.Plugin) (lens.Lens, error) {
+	if cfg.Command == "" {
+		return nil, errors.New("plugin has no command")
+	}
+
+	l := &pluginLens{
+		name:    cfg.Name,
+		command: config.ExpandHome(cfg.Command),
+		timeout: cfg.Timeout,
+	}
+	if l.timeout <= 0 {
+		l.timeout = defaultTimeout
+	}
+
+	if l.name == "" {
+		if err := l.call(context.Background(), "name", nil, &l.name); err != nil {
+			return nil, fmt.Errorf("plugin %q: %w", cfg.Command, err)
+		}
+		if l.name == "" {
+			return nil, fmt.Errorf("plugin %q has no name", cfg.Command)
+		}
+	}
+
+	return l, nil
+}
+
+func (l *pluginLens) Name() string {
+	return l.name
+}
+
+func (l *pluginLens) Search(query string) ([]lens.Entry, error) {
+	return l.SearchContext(context.Background(), query)
+}
+
+func (l *pluginLens) SearchContext(ctx context.Context, query string) ([]lens.Entry, error) {
+	var entries []lens.Entry
+	err := l.call(ctx, "search", map[string]string{"query": query}, &entries)
+	return entries, err
+}
+
+func (l *pluginLens) Enter(entry lens.Entry) error {
+	return l.call(context.Background(), "enter", map[string]any{"entry": entry}, nil)
+}
+
+func (l *pluginLens) ContextActions(entry lens.Entry) []lens.Action {
+	var actions []action
+	if err := l.call(context.Background(), "contextActions", map[string]any{"entry": entry}, &actions); err != nil {
+		return nil
+	}
+
+	result := make([]lens.Action, len(actions))
+	for i, a := range actions {
+		result[i] = lens.Action{
+			Name:  a.Name,
+			After: a.After,
+			Run: func(e lens.Entry) error {
+				params := map[string]any{"entry": e, "action": a.Name}
+				return l.call(context.Background(), "runAction", params, nil)
+			},
+		}
+	}
+	return result
+}
+
+// call sends a request to the plugin, starting it if it isn't running, and
+// decodes the result into result. A plugin that doesn't answer in time is
+// stopped.
+func (l *pluginLens) call(ctx context.Context, method string, params, result any) error {
+	p, err := l.process()
+	if err != nil {
+		return err
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	resp, err := p.call(callCtx, method, params)
+	if err != nil {
+		if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			p.kill()
+			return fmt.Errorf("%s didn't answer %s within %v", l.pluginName(), method, l.timeout)
+		}
+		return err
+	}
+
+	if resp.Error != nil {
+		return errors.New(resp.Error.Message)
+	}
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("%s: bad result for %s: %w", l.pluginName(), method, err)
+	}
+	return nil
+}
+
+// process returns the running plugin, starting it if it isn't running
+func (l *pluginLens) process() (*process, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil, fmt.Errorf("%s has been stopped", l.pluginName())
+	}
+	if l.proc != nil {
+		select {
+		case <-l.proc.done:
+			l.proc = nil
+		default:
+			return l.proc, nil
+		}
+	}
+
+	// Don't keep restarting a plugin that keeps failing
+	now := time.Now()
+	recent := l.starts[:0]
+	for _, t := range l.starts {
+		if now.Sub(t) < restartWindow {
+			recent = append(recent, t)
+		}
+	}
+	l.starts = recent
+	if len(l.starts) >= maxStarts {
+		return nil, fmt.Errorf("%s keeps failing, so it won't be restarted for a while", l.pluginName())
+	}
+
+	p, err := start(l.command, l.pluginName())
+	if err != nil {
+		return nil, err
+	}
+	l.proc = p
+	l.starts = append(l.starts, now)
+	return p, nil
+}
+
+// Close stops the plugin, giving it a moment to exit by itself first. Plugins
+// run in their own process group, so they'd outlive spyglass otherwise.
+func (l *pluginLens) Close() error {
+	l.mu.Lock()
+	p := l.proc
+	l.proc = nil
+	l.closed = true
+	l.mu.Unlock()
+
+	if p != nil {
+		p.stop(stopGrace)
+	}
+	return nil
+}
+
+// pluginName names the plugin in errors and logs
+func (l *pluginLens) pluginName() string {
+	if l.name != "" {
+		return "plugin " + l.name
+	}
+	return fmt.Sprintf("plugin %q", l.command)
+}
@@ -0,0 +1,203 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Largest message a plugin can send, in bytes
+const maxMessage = 16 << 20
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	// Notifications have no ID, and get no response
+	ID     *int   `json:"id,omitempty"`
+	Method string `json:"method"`
+	Params any    `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// process is a running plugin
+type process struct {
+	cmd *exec.Cmd
+
+	writeMu sync.Mutex
+	stdin   io.WriteCloser
+
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]chan rpcResponse
+
+	// done is closed once the plugin has exited, after err is set
+	done chan struct{}
+	err  error
+}
+
+// start runs command in the shell, in its own process group so that
+// anything it starts can be killed along with it
+func start(command, logName string) (*process, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &process{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[int]chan rpcResponse),
+		done:    make(chan struct{}),
+	}
+
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Printf("%s: %s", logName, scanner.Text())
+		}
+	}()
+
+	go p.read(stdout, logged)
+
+	return p, nil
+}
+
+// read hands each response to the call waiting for it, until the plugin's
+// output ends. logged is closed once its standard error has been read.
+func (p *process) read(stdout io.Reader, logged <-chan struct{}) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, maxMessage)
+
+	for scanner.Scan() {
+		var resp rpcResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			continue
+		}
+
+		p.mu.Lock()
+		ch, ok := p.pending[resp.ID]
+		delete(p.pending, resp.ID)
+		p.mu.Unlock()
+
+		if ok {
+			ch <- resp
+		}
+	}
+
+	<-logged
+
+	err := scanner.Err()
+	if waitErr := p.cmd.Wait(); err == nil {
+		err = waitErr
+	}
+	if err == nil {
+		err = errors.New("exited")
+	}
+
+	p.err = err
+	close(p.done)
+}
+
+// call sends a request and waits for its response
+func (p *process) call(ctx context.Context, method string, params any) (rpcResponse, error) {
+	ch := make(chan rpcResponse, 1)
+
+	p.mu.Lock()
+	p.nextID++
+	id := p.nextID
+	p.pending[id] = ch
+	p.mu.Unlock()
+
+	forget := func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}
+
+	if err := p.send(rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		forget()
+		return rpcResponse{}, err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+
+	case <-p.done:
+		forget()
+		return rpcResponse{}, fmt.Errorf("plugin stopped: %w", p.err)
+
+	case <-ctx.Done():
+		forget()
+		// Tell the plugin it can stop working on the request
+		_ = p.send(rpcRequest{JSONRPC: "2.0", Method: "$/cancelRequest", Params: map[string]int{"id": id}})
+		return rpcResponse{}, ctx.Err()
+	}
+}
+
+func (p *process) send(req rpcRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	_, err = p.stdin.Write(append(data, '\n'))
+	return err
+}
+
+// kill stops the plugin, and anything it started
+func (p *process) kill() {
+	if p.cmd.Process != nil {
+		_ = syscall.Kill(-p.cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// stop closes the plugin's standard input, which tells it to exit, and kills
+// it if it hasn't within grace
+func (p *process) stop(grace time.Duration) {
+	p.writeMu.Lock()
+	_ = p.stdin.Close()
+	p.writeMu.Unlock()
+
+	select {
+	case <-p.done:
+	case <-time.After(grace):
+		p.kill()
+	}
+}
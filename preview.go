@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/indium114/spyglass/lens"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// The preview pane is only shown when the window is at least this wide
+const previewMinWidth = 100
+
+// Number of previews kept in the cache
+const previewCacheSize = 64
+
+// How long a lens gets to produce a preview
+const previewTimeout = 5 * time.Second
+
+type preview struct {
+	text string
+	// False if the entry's lens doesn't have previews
+	ok  bool
+	err error
+}
+
+type previewMsg struct {
+	key string
+	preview
+}
+
+// previewCache keeps the most recently loaded previews
+type previewCache struct {
+	previews map[string]preview
+	// Keys, oldest first
+	order []string
+}
+
+func newPreviewCache() *previewCache {
+	return &previewCache{previews: make(map[string]preview)}
+}
+
+func (c *previewCache) get(key string) (preview, bool) {
+	p, ok := c.previews[key]
+	return p, ok
+}
+
+func (c *previewCache) put(key string, p preview) {
+	if _, ok := c.previews[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.previews[key] = p
+
+	if len(c.order) > previewCacheSize {
+		delete(c.previews, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// previewKey identifies an entry's preview by the lens the entry came from,
+// so the All tab shares previews with the other tabs
+func previewKey(l lens.Lens, entry lens.Entry) string {
+	origin, e := lens.Origin(l, entry)
+	return origin.Name() + "\x1f" + e.ID
+}
+
+// previewShown reports whether there's room for the preview pane, and the
+// active lens might have previews
+func (m model) previewShown() bool {
+	if m.layout.Preview <= 0 || m.width < previewMinWidth || m.state != stateEntries {
+		return false
+	}
+
+	switch m.lenses[m.activeLens].(type) {
+	case lens.Previewer, lens.Resolver:
+		return true
+	}
+	return false
+}
+
+// loadPreview starts loading the preview of the selected entry, unless it's
+// cached or already loading
+func (m *model) loadPreview() tea.Cmd {
+	if !m.previewShown() || len(m.entries) == 0 {
+		return nil
+	}
+
+	l := m.lenses[m.activeLens]
+	entry := m.entries[m.selected]
+	key := previewKey(l, entry)
+	if key == m.previewKey {
+		return nil
+	}
+
+	if m.cancelPreview != nil {
+		m.cancelPreview()
+		m.cancelPreview = nil
+	}
+	m.previewKey = key
+	if _, ok := m.previews.get(key); ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), previewTimeout)
+	m.cancelPreview = cancel
+
+	return func() tea.Msg {
+		defer cancel()
+		text, ok, err := lens.Preview(ctx, l, entry)
+		return previewMsg{key: key, preview: preview{text: text, ok: ok, err: err}}
+	}
+}
+
+// receivePreview caches a loaded preview. Previews cancelled because the
+// selection moved on are dropped, so they're loaded again if it comes back.
+func (m *model) receivePreview(msg previewMsg) {
+	if errors.Is(msg.err, context.Canceled) {
+		return
+	}
+	m.previews.put(msg.key, msg.preview)
+}
+
+// renderPreview renders the selected entry's preview, cut to fit into width
+// by height cells
+func (m model) renderPreview(width, height int) string {
+	p, ok := m.previews.get(m.previewKey)
+	switch {
+	case len(m.entries) == 0:
+		return ""
+	case !ok:
+		return m.styles.badge.Render("Loading…")
+	case p.err != nil:
+		return m.styles.err.Render(ansi.Truncate(p.err.Error(), width, "…"))
+	case !p.ok:
+		return m.styles.badge.Render("No preview")
+	}
+
+	lines := strings.Split(p.text, "\n")
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		line = strings.ReplaceAll(line, "\t", "    ")
+		lines[i] = ansi.Truncate(line, width, "") + ansi.ResetStyle
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/indium114/spyglass/lens"
+	"github.com/indium114/spyglass/theme"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/rivo/uniseg"
+)
+
+type styles struct {
+	border       lipgloss.Border
+	borderColor  lipgloss.TerminalColor
+	activeBorder lipgloss.TerminalColor
+
+	// Cursor shown before the selected row, and the blank shown before the
+	// others
+	cursor   string
+	noCursor string
+
+	activeTab   lipgloss.Style
+	marker      lipgloss.Style
+	badge       lipgloss.Style
+	description lipgloss.Style
+	err         lipgloss.Style
+
+	// Text of unselected and selected rows, and the matched characters in each
+	normal        lipgloss.Style
+	selected      lipgloss.Style
+	match         lipgloss.Style
+	selectedMatch lipgloss.Style
+}
+
+func newStyles(t theme.Theme) styles {
+	selected := lipgloss.NewStyle().
+		Foreground(theme.Color(t.Selection)).
+		Background(theme.Color(t.SelectionBackground))
+	match := lipgloss.NewStyle().
+		Foreground(theme.Color(t.Match)).
+		Bold(true)
+
+	cursor := t.Cursor
+	if cursor == "" {
+		cursor = "> "
+	}
+
+	return styles{
+		border:       t.Borders(),
+		borderColor:  theme.Color(t.Border),
+		activeBorder: theme.Color(t.ActiveBorder),
+
+		cursor:   cursor,
+		noCursor: strings.Repeat(" ", lipgloss.Width(cursor)),
+
+		activeTab:   lipgloss.NewStyle().Foreground(theme.Color(t.Accent)).Bold(true),
+		marker:      lipgloss.NewStyle().Foreground(theme.Color(t.Accent)),
+		badge:       lipgloss.NewStyle().Foreground(theme.Color(t.Dim)),
+		description: lipgloss.NewStyle().Foreground(theme.Color(t.Description)),
+		err:         lipgloss.NewStyle().Foreground(theme.Color(t.Error)),
+
+		normal:        lipgloss.NewStyle(),
+		selected:      selected,
+		match:         match,
+		selectedMatch: match.Background(theme.Color(t.SelectionBackground)),
+	}
+}
+
+// newHelp returns the help view, styled to match the theme
+func newHelp(t theme.Theme) help.Model {
+	h := help.New()
+	h.ShowAll = true
+	h.Styles.FullKey = lipgloss.NewStyle().Foreground(theme.Color(t.Accent))
+	h.Styles.FullDesc = lipgloss.NewStyle().Foreground(theme.Color(t.Description))
+	h.Styles.FullSeparator = lipgloss.NewStyle().Foreground(theme.Color(t.Dim))
+	return h
+}
+
+// renderCursor returns the cursor for a row
+func (s styles) renderCursor(selected bool) string {
+	if selected {
+		return s.cursor
+	}
+	return s.noCursor
+}
+
+// renderMarker returns the column showing whether a row is marked
+func (s styles) renderMarker(marked bool) string {
+	if marked {
+		return s.marker.Render("● ")
+	}
+	return "  "
+}
+
+// renderRow renders a plain row, like a context menu action
+func (s styles) renderRow(text string, selected bool, width int) string {
+	prefix := s.renderCursor(selected)
+	return prefix + s.renderHighlighted(text, nil, selected, width-lipgloss.Width(prefix))
+}
+
+// renderEntry renders one row of the result list, fitting it into width
+// cells. Runes of the title that matched the query are highlighted, and the
+// entry's badge is right-aligned. marker is shown between the cursor and the
+// icon.
+func (s styles) renderEntry(e lens.Entry, selected bool, marker string, width int) string {
+	prefix := s.renderCursor(selected) + marker + e.Icon + " "
+	width -= lipgloss.Width(prefix)
+
+	if e.Badge == "" {
+		return prefix + s.renderHighlighted(e.Title, e.Matches, selected, width)
+	}
+
+	badge := " " + e.Badge
+	title := s.renderHighlighted(e.Title, e.Matches, selected, width-lipgloss.Width(badge))
+	gap := max(width-lipgloss.Width(title)-lipgloss.Width(badge), 0)
+
+	return prefix + title + strings.Repeat(" ", gap) + s.badge.Render(badge)
+}
+
+// renderHighlighted renders text with the runes at the given indexes in
+// the match style, truncating it with an ellipsis if it is wider than width.
+// Grapheme clusters are kept whole, and one is highlighted if any of its
+// runes matched.
+func (s styles) renderHighlighted(text string, matches []int, selected bool, width int) string {
+	if width <= 0 {
+		return ""
+	}
+
+	base, hl := s.normal, s.match
+	if selected {
+		base, hl = s.selected, s.selectedMatch
+	}
+
+	matched := make(map[int]bool, len(matches))
+	for _, i := range matches {
+		matched[i] = true
+	}
+
+	truncate := uniseg.StringWidth(text) > width
+	if truncate {
+		// Leave room for the ellipsis
+		width--
+	}
+
+	var b strings.Builder
+
+	// Consecutive graphemes with the same highlighting are rendered together
+	var run strings.Builder
+	runMatched := false
+	flush := func() {
+		if run.Len() == 0 {
+			return
+		}
+		if runMatched {
+			b.WriteString(hl.Render(run.String()))
+		} else {
+			b.WriteString(base.Render(run.String()))
+		}
+		run.Reset()
+	}
+
+	used, r := 0, 0
+	g := uniseg.NewGraphemes(text)
+	for g.Next() {
+		w := g.Width()
+		if used+w > width {
+			break
+		}
+		used += w
+
+		runes := g.Runes()
+		isMatch := false
+		for i := range runes {
+			if matched[r+i] {
+				isMatch = true
+				break
+			}
+		}
+		r += len(runes)
+
+		if isMatch != runMatched {
+			flush()
+			runMatched = isMatch
+		}
+		run.WriteString(g.Str())
+	}
+	flush()
+
+	if truncate {
+		b.WriteString(base.Render("…"))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/indium114/spyglass/lens"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Most results kept for a search. Lower ranked ones are dropped as they
+// arrive, which keeps streaming a large index quick.
+const maxResults = 5000
+
+// searchMsg carries one batch of results from a running search. The final
+// message of a search has done set, and may carry the search's error.
+type searchMsg struct {
+	gen     int
+	entries []lens.Entry
+	done    bool
+	err     error
+}
+
+// refresh cancels any running search and returns a command that starts
+// searching the active lens for the current query
+func (m *model) refresh() tea.Cmd {
+	if m.cancelSearch != nil {
+		m.cancelSearch()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelSearch = cancel
+	m.searchGen++
+
+	gen := m.searchGen
+	l := m.lenses[m.activeLens]
+	query := strings.TrimSpace(m.search.Value())
+	hist := m.history
+
+	results := make(chan searchMsg)
+	m.results = results
+	m.lastQuery = query
+	m.received = false
+	m.loading = true
+
+	// send gives up once the search is cancelled, so stale searches never
+	// block on a channel nobody is reading anymore
+	send := func(msg searchMsg) {
+		select {
+		case results <- msg:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		err := lens.SearchStream(ctx, l, query, func(batch []lens.Entry) {
+			// Frequently and recently launched entries rank higher
+			batch = slices.Clone(batch)
+			for i := range batch {
+				origin, e := lens.Origin(l, batch[i])
+				batch[i].Score += hist.Boost(origin.Name(), e.ID)
+			}
+			send(searchMsg{gen: gen, entries: batch})
+		})
+		send(searchMsg{gen: gen, done: true, err: err})
+	}()
+
+	// Searching may set the lens to work, like indexing, so check on it
+	var poll tea.Cmd
+	if !m.pollingLens {
+		m.pollingLens = true
+		poll = m.pollLensStatus()
+	}
+
+	return tea.Batch(waitForResults(results), poll)
+}
+
+func waitForResults(results <-chan searchMsg) tea.Cmd {
+	return func() tea.Msg {
+		return <-results
+	}
+}
+
+// receive applies a batch of results, and keeps listening for more until
+// the search is done
+func (m *model) receive(msg searchMsg) tea.Cmd {
+	if msg.gen != m.searchGen {
+		// A newer search has been started since
+		return nil
+	}
+
+	// The previous results stay on screen until the first batch of the new
+	// search arrives, so the list doesn't flicker while typing
+	if !m.received {
+		m.entries = nil
+		m.received = true
+	}
+	m.entries = mergeRanked(m.entries, msg.entries, maxResults)
+
+	if m.selected >= len(m.entries) {
+		m.selected = len(m.entries) - 1
+	}
+	if m.selected < 0 {
+		m.selected = 0
+	}
+
+	if msg.done {
+		m.loading = false
+		if msg.err != nil && !errors.Is(msg.err, context.Canceled) {
+			return m.reportError(m.lenses[m.activeLens].Name(), msg.err)
+		}
+		return nil
+	}
+	return waitForResults(m.results)
+}
+
+// mergeRanked merges a batch of results into entries, which is already
+// sorted by score, keeping the best limit of them. Entries with equal scores
+// keep the order the lens gave them in. batch is sorted in place.
+func mergeRanked(entries, batch []lens.Entry, limit int) []lens.Entry {
+	// Once entries is full, only better results can get in
+	if len(entries) >= limit {
+		last := entries[len(entries)-1].Score
+		batch = slices.DeleteFunc(batch, func(e lens.Entry) bool {
+			return e.Score <= last
+		})
+	}
+	if len(batch) == 0 {
+		return entries
+	}
+
+	slices.SortStableFunc(batch, func(a, b lens.Entry) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+
+	// Entries ranked above the whole batch stay where they are, so only the
+	// rest are moved
+	keep := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Score < batch[0].Score
+	})
+	n := min(len(entries)+len(batch), limit)
+	if keep >= n {
+		return entries[:n]
+	}
+
+	rest := entries[keep:]
+	merged := make([]lens.Entry, 0, n-keep)
+	i, j := 0, 0
+	for len(merged) < cap(merged) && (i < len(rest) || j < len(batch)) {
+		if j < len(batch) && (i == len(rest) || batch[j].Score > rest[i].Score) {
+			merged = append(merged, batch[j])
+			j++
+		} else {
+			merged = append(merged, rest[i])
+			i++
+		}
+	}
+
+	return append(entries[:keep], merged...)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/indium114/spyglass/lens"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// How long a status message stays on screen
+const statusTimeout = 5 * time.Second
+
+// How often the active lens is asked what it's busy with, while it is
+const lensStatusEvery = 500 * time.Millisecond
+
+// Once the log file grows past this, it's moved to spyglass.log.1 and a new
+// one is started
+const maxLogSize = 1 << 20
+
+// clearStatusMsg clears the status line, unless a newer message has been
+// shown since
+type clearStatusMsg struct {
+	id int
+}
+
+// setStatus shows a message in the status line for a few seconds
+func (m *model) setStatus(text string, isErr bool) tea.Cmd {
+	m.statusID++
+	m.status = text
+	m.statusErr = isErr
+
+	id := m.statusID
+	return tea.Tick(statusTimeout, func(time.Time) tea.Msg {
+		return clearStatusMsg{id: id}
+	})
+}
+
+// lensStatusMsg carries what a lens is busy with, if anything
+type lensStatusMsg struct {
+	lens int
+	text string
+}
+
+// pollLensStatus returns a command that asks the active lens what it's busy
+// with, after a moment
+func (m *model) pollLensStatus() tea.Cmd {
+	i := m.activeLens
+	s, ok := m.lenses[i].(lens.Statuser)
+	if !ok {
+		return func() tea.Msg {
+			return lensStatusMsg{lens: i}
+		}
+	}
+
+	return tea.Tick(lensStatusEvery, func(time.Time) tea.Msg {
+		return lensStatusMsg{lens: i, text: s.Status()}
+	})
+}
+
+// receiveLensStatus shows what a lens is busy with, and keeps asking until
+// the active lens isn't busy
+func (m *model) receiveLensStatus(msg lensStatusMsg) tea.Cmd {
+	if msg.lens != m.activeLens {
+		// Switched lenses since
+		return m.pollLensStatus()
+	}
+
+	m.lensStatus = msg.text
+	if msg.text == "" {
+		m.pollingLens = false
+		return nil
+	}
+	return m.pollLensStatus()
+}
+
+// reportError logs err and shows it in the status line
+func (m *model) reportError(context string, err error) tea.Cmd {
+	text := fmt.Sprintf("%s: %v", context, err)
+	log.Println(text)
+	return m.setStatus(text, true)
+}
+
+// logPath returns the location of the log file
+func logPath() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheDir, "spyglass", "spyglass.log")
+}
+
+// setupLog sends the standard logger to the log file. If the file can't be
+// opened, logs are discarded rather than drawn over the interface.
+func setupLog() io.Closer {
+	log.SetOutput(io.Discard)
+
+	path := logPath()
+	if path == "" {
+		return io.NopCloser(nil)
+	}
+	_ = os.MkdirAll(filepath.Dir(path), 0755)
+
+	if info, err := os.Stat(path); err == nil && info.Size() > maxLogSize {
+		_ = os.Rename(path, path+".1")
+	}
+
+	f, err := tea.LogToFile(path, "spyglass")
+	if err != nil {
+		return io.NopCloser(nil)
+	}
+	return f
+}
@@ -0,0 +1,205 @@
+// Package theme defines the colours and glyphs spyglass is drawn with.
+//
+// Themes are either built in, or read from YAML files in the themes
+// directory. Colours are hex codes like "#cba6f7", or ANSI colour numbers
+// like "5" to use the terminal's own palette. An empty colour leaves the
+// terminal's default.
+package theme
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"gopkg.in/yaml.v3"
+)
+
+type Theme struct {
+	// Borders around the tabs, results and description
+	Border string `yaml:"border"`
+	// Border around the search box
+	ActiveBorder string `yaml:"active_border"`
+	// One of rounded, normal, thick, double, block, ascii or hidden
+	BorderStyle string `yaml:"border_style"`
+
+	// The active tab
+	Accent string `yaml:"accent"`
+	// Badges, keywords and other secondary text
+	Dim string `yaml:"dim"`
+
+	// The selected row
+	Selection           string `yaml:"selection"`
+	SelectionBackground string `yaml:"selection_background"`
+	// Shown before the selected row
+	Cursor string `yaml:"cursor"`
+
+	// Description text
+	Description string `yaml:"description"`
+	// Characters that matched the query
+	Match string `yaml:"match"`
+	// Error messages
+	Error string `yaml:"error"`
+}
+
+// DefaultName is the theme used when none is configured
+const DefaultName = "catppuccin-mocha"
+
+var builtin = map[string]Theme{
+	"catppuccin-mocha":     catppuccin("#313244", "#cba6f7", "#6c7086", "#cdd6f4", "#b4befe", "#f38ba8"),
+	"catppuccin-macchiato": catppuccin("#363a4f", "#c6a0f6", "#6e738d", "#cad3f5", "#b7bdf8", "#ed8796"),
+	"catppuccin-frappe":    catppuccin("#414559", "#ca9ee6", "#737994", "#c6d0f5", "#babbf1", "#e78284"),
+	"catppuccin-latte":     catppuccin("#ccd0da", "#8839ef", "#9ca0b0", "#4c4f69", "#7287fd", "#d20f39"),
+	"gruvbox": {
+		Border:       "#504945",
+		ActiveBorder: "#fabd2f",
+		BorderStyle:  "rounded",
+		Accent:       "#fabd2f",
+		Dim:          "#928374",
+		Selection:    "#fe8019",
+		Cursor:       "> ",
+		Description:  "#ebdbb2",
+		Match:        "#fabd2f",
+		Error:        "#fb4934",
+	},
+	"nord": {
+		Border:       "#3b4252",
+		ActiveBorder: "#88c0d0",
+		BorderStyle:  "rounded",
+		Accent:       "#88c0d0",
+		Dim:          "#4c566a",
+		Selection:    "#81a1c1",
+		Cursor:       "> ",
+		Description:  "#d8dee9",
+		Match:        "#88c0d0",
+		Error:        "#bf616a",
+	},
+	// Uses the terminal's 16 colours, so it follows the terminal's palette
+	"ansi": {
+		Border:       "8",
+		ActiveBorder: "5",
+		BorderStyle:  "rounded",
+		Accent:       "5",
+		Dim:          "8",
+		Selection:    "4",
+		Cursor:       "> ",
+		Match:        "5",
+		Error:        "1",
+	},
+}
+
+func catppuccin(surface, mauve, overlay, text, lavender, red string) Theme {
+	return Theme{
+		Border:       surface,
+		ActiveBorder: mauve,
+		BorderStyle:  "rounded",
+		Accent:       mauve,
+		Dim:          overlay,
+		Selection:    lavender,
+		Cursor:       "> ",
+		Description:  text,
+		Match:        mauve,
+		Error:        red,
+	}
+}
+
+// Names returns the names of the built-in themes
+func Names() []string {
+	var names []string
+	for name := range builtin {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Load returns the named theme. A file called <name>.yaml in dir takes
+// precedence over a built-in theme of the same name. Settings missing from a
+// theme file are taken from the default theme.
+func Load(dir, name string) (Theme, error) {
+	if name == "" {
+		name = DefaultName
+	}
+
+	path := filepath.Join(dir, name+".yaml")
+	data, err := os.ReadFile(path)
+	if err == nil {
+		t := builtin[DefaultName]
+		if err := yaml.Unmarshal(data, &t); err != nil {
+			return Theme{}, fmt.Errorf("%s: %w", path, err)
+		}
+		return t, t.Validate()
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return Theme{}, err
+	}
+
+	t, ok := builtin[name]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme %q, expected one of %s or a file in %s",
+			name, strings.Join(Names(), ", "), dir)
+	}
+	return t, nil
+}
+
+// Override returns t with every setting that is set in o replaced
+func (t Theme) Override(o Theme) Theme {
+	set := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+
+	set(&t.Border, o.Border)
+	set(&t.ActiveBorder, o.ActiveBorder)
+	set(&t.BorderStyle, o.BorderStyle)
+	set(&t.Accent, o.Accent)
+	set(&t.Dim, o.Dim)
+	set(&t.Selection, o.Selection)
+	set(&t.SelectionBackground, o.SelectionBackground)
+	set(&t.Cursor, o.Cursor)
+	set(&t.Description, o.Description)
+	set(&t.Match, o.Match)
+	set(&t.Error, o.Error)
+
+	return t
+}
+
+var borders = map[string]lipgloss.Border{
+	"rounded": lipgloss.RoundedBorder(),
+	"normal":  lipgloss.NormalBorder(),
+	"thick":   lipgloss.ThickBorder(),
+	"double":  lipgloss.DoubleBorder(),
+	"block":   lipgloss.BlockBorder(),
+	"ascii":   lipgloss.ASCIIBorder(),
+	"hidden":  lipgloss.HiddenBorder(),
+}
+
+// Validate checks that the theme's settings are understood
+func (t Theme) Validate() error {
+	if _, ok := borders[t.BorderStyle]; !ok && t.BorderStyle != "" {
+		return fmt.Errorf("unknown border style %q", t.BorderStyle)
+	}
+	return nil
+}
+
+// Borders returns the theme's border style, falling back to rounded borders
+func (t Theme) Borders() lipgloss.Border {
+	if b, ok := borders[t.BorderStyle]; ok {
+		return b
+	}
+	return lipgloss.RoundedBorder()
+}
+
+// Color converts one of the theme's colours for use with lipgloss. Empty
+// colours become lipgloss.NoColor, leaving the terminal's default.
+func Color(c string) lipgloss.TerminalColor {
+	if c == "" {
+		return lipgloss.NoColor{}
+	}
+	return lipgloss.Color(c)
+}